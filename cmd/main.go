@@ -3,17 +3,24 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
 	"go-service/internal/analytics"
 	"go-service/internal/cache"
+	"go-service/internal/config"
 	"go-service/internal/models"
+	"go-service/internal/notify"
+	"go-service/internal/usage"
 
 	"github.com/gorilla/mux"
 	"github.com/prometheus/client_golang/prometheus"
@@ -52,52 +59,228 @@ var (
 		Name: "rolling_average",
 		Help: "Rolling average of metrics",
 	})
+
+	pipelineLatency = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "ingest_pipeline_latency_seconds",
+		Help:    "Time from metric ingest to completed analysis, including queueing and metric cache write",
+		Buckets: prometheus.ExponentialBuckets(0.001, 2, 16),
+	})
+)
+
+const (
+	defaultSeriesPoints = 500
+	maxSeriesPoints     = 10000
+	maxUsageRange       = 366 * 24 * time.Hour
+	maxAlertAnomalies   = 100 // последние аномалии, по которым строятся алерты
+	timeoutGrace        = time.Second
 )
 
 type Server struct {
+	cfg         config.Config
 	router      *mux.Router
 	cache       *cache.RedisClient
 	analyzer    *analytics.Analyzer
+	notifier    *notify.Notifier
+	usage       *usage.Tracker
+	migrator    *cache.Migrator
 	metricsChan chan models.Metric
 }
 
-func NewServer(redisAddr string) (*Server, error) {
-	redisClient, err := cache.NewRedisClient(redisAddr)
+// Маршруты чтения данных, учитываемые как query в статистике использования
+var queryRoutes = map[string]bool{
+	"/metrics/series":      true,
+	"/analytics/current":   true,
+	"/analytics/anomalies": true,
+	"/alerts/alertmanager": true,
+	"/annotations":         true,
+}
+
+func NewServer(cfg config.Config) (*Server, error) {
+	redisClient, err := cache.NewRedisClient(cfg.Redis.Addr, cfg.Redis.ReadAddrs...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
 	}
 
-	analyzer := analytics.NewAnalyzer(50, 2.0) // window=50, threshold=2σ
+	analyzer := analytics.NewAnalyzer(cfg.Analyzer.WindowSize, cfg.Analyzer.ZScoreThreshold,
+		cfg.Analyzer.DeviceIdleTTL, cfg.Analyzer.MaxDevices, cfg.Alertmanager.ActiveWindow)
+	err = analyzer.SetConfig(models.AnalyzerConfig{Global: analyzerDefaults(cfg.Analyzer)})
+	if err != nil {
+		return nil, fmt.Errorf("invalid analyzer config: %w", err)
+	}
+
+	notifier, err := notify.NewNotifier(cfg.Notifications, cfg.Devices)
+	if err != nil {
+		return nil, fmt.Errorf("invalid notifications config: %w", err)
+	}
+
 	metricsChan := make(chan models.Metric, 10000)
 
 	s := &Server{
+		cfg:         cfg,
 		router:      mux.NewRouter(),
 		cache:       redisClient,
 		analyzer:    analyzer,
+		notifier:    notifier,
+		usage:       usage.NewTracker(redisClient, cfg.Usage.APIKeys),
+		migrator:    cache.NewMigrator(redisClient),
 		metricsChan: metricsChan,
 	}
 
 	s.setupRoutes()
-	go s.processMetrics()
+	if !cfg.Server.ReadOnly {
+		// Изменения настроек, сделанные через API на любом экземпляре
+		if err := s.reloadAnalyzerConfig(); err != nil {
+			log.Printf("Failed to load analyzer config: %v", err)
+		}
+		go s.watchAnalyzerConfig()
+		go s.processMetrics()
+		go s.notifier.Run()
+		if cfg.Alertmanager.URL != "" {
+			go s.pushAlerts()
+		}
+	}
+	go s.usage.Run(cfg.Usage.FlushInterval)
 
 	return s, nil
 }
 
 func (s *Server) setupRoutes() {
-	s.router.HandleFunc("/health", s.healthHandler).Methods("GET")
-	s.router.HandleFunc("/metrics/ingest", s.ingestMetricsHandler).Methods("POST")
-	s.router.HandleFunc("/analytics/current", s.getAnalyticsHandler).Methods("GET")
-	s.router.HandleFunc("/analytics/anomalies", s.getAnomaliesHandler).Methods("GET")
+	s.handle("/health", s.healthHandler).Methods("GET")
+	s.handleWrite("/metrics/ingest", s.ingestMetricsHandler).Methods("POST")
+	s.handle("/metrics/series", s.getSeriesHandler).Methods("GET")
+	s.handle("/analytics/current", s.getAnalyticsHandler).Methods("GET")
+	s.handle("/analytics/anomalies", s.getAnomaliesHandler).Methods("GET")
+	s.handle("/alerts/alertmanager", s.getAlertsHandler).Methods("GET")
+	s.handleWrite("/annotations", s.createAnnotationHandler).Methods("POST")
+	s.handle("/annotations", s.getAnnotationsHandler).Methods("GET")
+	// Реплики отдают настройки, опубликованные пишущими экземплярами в Redis
+	s.handle("/config/analyzer", s.getAnalyzerConfigHandler).Methods("GET")
+	s.handleWrite("/config/analyzer", s.updateAnalyzerConfigHandler).Methods("PUT")
+	s.handle("/usage", s.getUsageHandler).Methods("GET")
+	s.handle("/admin/migrations", s.getMigrationStatusHandler).Methods("GET")
+	s.handleWrite("/admin/migrations", s.startMigrationHandler).Methods("POST")
 	s.router.Handle("/metrics/prometheus", promhttp.Handler())
+	s.router.Use(s.usageMiddleware)
+}
+
+// handle регистрирует обработчик с таймаутом маршрута из конфигурации, если он задан.
+func (s *Server) handle(path string, handler http.HandlerFunc) *mux.Route {
+	timeout, ok := s.cfg.Server.RouteTimeouts[path]
+	if !ok {
+		return s.router.HandleFunc(path, handler)
+	}
+	return s.router.Handle(path, withTimeout(timeout, handler))
+}
+
+// handleWrite регистрирует маршрут пишущего экземпляра. В режиме только
+// для чтения такие запросы отклоняются.
+func (s *Server) handleWrite(path string, handler http.HandlerFunc) *mux.Route {
+	if s.cfg.Server.ReadOnly {
+		return s.handle(path, readOnlyHandler)
+	}
+	return s.handle(path, handler)
+}
+
+func readOnlyHandler(w http.ResponseWriter, r *http.Request) {
+	http.Error(w, "read-only replica: send writes to the primary instance", http.StatusForbidden)
+	httpRequestsTotal.WithLabelValues(r.Method, r.URL.Path, "403").Inc()
+}
+
+// usageMiddleware учитывает объём приёма и чтения данных по тенанту,
+// определённому по заголовку X-API-Key.
+func (s *Server) usageMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, _ := mux.CurrentRoute(r).GetPathTemplate()
+
+		var category string
+		switch {
+		case r.Method == http.MethodPost && path == "/metrics/ingest":
+			category = usage.Ingest
+		case r.Method == http.MethodGet && queryRoutes[path]:
+			category = usage.Query
+		default:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body := &countingReader{ReadCloser: r.Body}
+		r.Body = body
+		cw := &countingWriter{ResponseWriter: w}
+
+		next.ServeHTTP(cw, r)
+
+		bytes := cw.n
+		if category == usage.Ingest {
+			bytes = body.n
+		}
+		s.usage.Record(s.usage.Tenant(r.Header.Get("X-API-Key")), category, bytes)
+	})
+}
+
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+type countingWriter struct {
+	http.ResponseWriter
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.ResponseWriter.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Unwrap нужен http.ResponseController для установки дедлайнов
+func (c *countingWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+// withTimeout ограничивает время работы обработчика: по истечении timeout
+// клиент получает 503, а контекст запроса отменяется вместе с запросами
+// к Redis, выполняемыми в нём. Серверные дедлайны чтения/записи соединения
+// переопределяются, чтобы долгие ответы (выгрузки, запросы за большой
+// период) не обрывались глобальным WriteTimeout.
+func withTimeout(timeout time.Duration, next http.HandlerFunc) http.Handler {
+	handler := http.TimeoutHandler(next, timeout, "request timed out")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Соединение живёт чуть дольше обработчика, чтобы ответ 503 успел уйти
+		deadline := time.Now().Add(timeout + timeoutGrace)
+
+		rc := http.NewResponseController(w)
+		if err := rc.SetWriteDeadline(deadline); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			log.Printf("Failed to set write deadline for %s: %v", r.URL.Path, err)
+		}
+		if err := rc.SetReadDeadline(deadline); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			log.Printf("Failed to set read deadline for %s: %v", r.URL.Path, err)
+		}
+
+		handler.ServeHTTP(w, r)
+	})
 }
 
 func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
 
+	mode := "read-write"
+	if s.cfg.Server.ReadOnly {
+		mode = "read-only"
+	}
+
 	health := map[string]interface{}{
 		"status":    "healthy",
 		"timestamp": time.Now().UTC(),
 		"version":   "1.0.0",
+		"mode":      mode,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -119,6 +302,7 @@ func (s *Server) ingestMetricsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	metric.Timestamp = time.Now()
+	metric.ReceivedAt = metric.Timestamp
 
 	// Отправляем метрику в канал для обработки
 	select {
@@ -147,20 +331,107 @@ func (s *Server) processMetrics() {
 		// Анализ метрики
 		analysis := s.analyzer.Analyze(metric)
 
-		// Обновляем Prometheus метрики
-		rollingAverage.Set(analysis.RollingAverage)
+		// Тот же интервал, что и в pipeline_latency_ms результата анализа
+		pipelineLatency.Observe(analysis.PipelineLatencyMs / 1000)
+
+		// Публикуем состояние анализа для реплик чтения
+		stats := s.analyzer.GetCurrentStats()
+		if err := s.cache.StoreAnalysis(stats, analysis); err != nil {
+			log.Printf("Failed to store analysis: %v", err)
+		}
+
+		// Обновляем Prometheus метрики; скользящее среднее - общее по всем устройствам
+		rollingAverage.Set(stats.RollingAverage)
 
 		if analysis.IsAnomaly {
 			anomaliesDetected.Inc()
-			log.Printf("Anomaly detected: RPS=%.2f, Z-score=%.2f", metric.RPS, analysis.ZScore)
+			log.Printf("Anomaly detected: RPS=%.2f, Z-score=%.2f, %s=%.2f", metric.RPS, analysis.ZScore, analysis.Detector, analysis.Score)
+			s.notifier.Notify(analysis)
+		}
+	}
+}
+
+func (s *Server) getSeriesHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	query := r.URL.Query()
+
+	deviceID := query.Get("device_id")
+	if deviceID == "" {
+		http.Error(w, "device_id is required", http.StatusBadRequest)
+		httpRequestsTotal.WithLabelValues(r.Method, r.URL.Path, "400").Inc()
+		return
+	}
+
+	from, to, err := parseTimeRange(r, start, time.Hour)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		httpRequestsTotal.WithLabelValues(r.Method, r.URL.Path, "400").Inc()
+		return
+	}
+
+	maxPoints := defaultSeriesPoints
+	if v := query.Get("max_points"); v != "" {
+		maxPoints, err = strconv.Atoi(v)
+		if err != nil || maxPoints <= 0 || maxPoints > maxSeriesPoints {
+			http.Error(w, fmt.Sprintf("max_points must be between 1 and %d", maxSeriesPoints), http.StatusBadRequest)
+			httpRequestsTotal.WithLabelValues(r.Method, r.URL.Path, "400").Inc()
+			return
 		}
 	}
+
+	res := cache.ChooseResolution(from, to, start, maxPoints)
+	points, err := s.cache.GetSeries(r.Context(), deviceID, from, to, res)
+	if err != nil {
+		log.Printf("Failed to load series: %v", err)
+		http.Error(w, "failed to load series", http.StatusInternalServerError)
+		httpRequestsTotal.WithLabelValues(r.Method, r.URL.Path, "500").Inc()
+		return
+	}
+
+	// Если точек больше лимита, доагрегируем до шага, дающего не более maxPoints интервалов
+	step := res.Step
+	if len(points) > maxPoints {
+		step = (to.Sub(from) / time.Duration(maxPoints)).Truncate(time.Second) + time.Second
+		points = cache.Downsample(points, from, step)
+	}
+
+	annotations, err := s.cache.GetAnnotations(r.Context(), from, to, deviceID)
+	if err != nil {
+		log.Printf("Failed to load annotations: %v", err)
+	}
+
+	response := models.SeriesResponse{
+		DeviceID:    deviceID,
+		From:        from,
+		To:          to,
+		Resolution:  res.Name,
+		StepSeconds: step.Seconds(),
+		Points:      points,
+		Annotations: annotations,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+
+	duration := time.Since(start).Seconds()
+	requestDuration.WithLabelValues(r.Method, r.URL.Path).Observe(duration)
+	httpRequestsTotal.WithLabelValues(r.Method, r.URL.Path, "200").Inc()
 }
 
 func (s *Server) getAnalyticsHandler(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
 
 	analyticsData := s.analyzer.GetCurrentStats()
+	if s.cfg.Server.ReadOnly {
+		var err error
+		analyticsData, err = s.cache.GetStats()
+		if err != nil {
+			log.Printf("Failed to load stats: %v", err)
+			http.Error(w, "failed to load stats", http.StatusInternalServerError)
+			httpRequestsTotal.WithLabelValues(r.Method, r.URL.Path, "500").Inc()
+			return
+		}
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(analyticsData)
@@ -173,7 +444,14 @@ func (s *Server) getAnalyticsHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Server) getAnomaliesHandler(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
 
-	anomalies := s.analyzer.GetRecentAnomalies(10)
+	anomalies, err := s.recentAnomalies(10)
+	if err != nil {
+		log.Printf("Failed to load anomalies: %v", err)
+		http.Error(w, "failed to load anomalies", http.StatusInternalServerError)
+		httpRequestsTotal.WithLabelValues(r.Method, r.URL.Path, "500").Inc()
+		return
+	}
+	s.attachAnnotations(r.Context(), anomalies)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(anomalies)
@@ -183,13 +461,409 @@ func (s *Server) getAnomaliesHandler(w http.ResponseWriter, r *http.Request) {
 	httpRequestsTotal.WithLabelValues(r.Method, r.URL.Path, "200").Inc()
 }
 
-func (s *Server) Run(addr string) error {
+// recentAnomalies возвращает последние аномалии: из анализатора или,
+// в режиме только для чтения, из общего Redis.
+func (s *Server) recentAnomalies(limit int) ([]models.AnalysisResult, error) {
+	if s.cfg.Server.ReadOnly {
+		return s.cache.GetRecentAnomalies(int64(limit))
+	}
+	return s.analyzer.GetRecentAnomalies(limit), nil
+}
+
+// activeAlerts строит алерты Alertmanager по активным аномалиям
+func (s *Server) activeAlerts(ctx context.Context) ([]notify.Alert, error) {
+	anomalies, err := s.recentAnomalies(maxAlertAnomalies)
+	if err != nil {
+		return nil, err
+	}
+	s.attachAnnotations(ctx, anomalies)
+
+	return notify.BuildAlerts(anomalies, s.cfg.Devices, s.cfg.Alertmanager.ActiveWindow, time.Now()), nil
+}
+
+func (s *Server) getAlertsHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	alerts, err := s.activeAlerts(r.Context())
+	if err != nil {
+		log.Printf("Failed to build alerts: %v", err)
+		http.Error(w, "failed to build alerts", http.StatusInternalServerError)
+		httpRequestsTotal.WithLabelValues(r.Method, r.URL.Path, "500").Inc()
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(alerts)
+
+	duration := time.Since(start).Seconds()
+	requestDuration.WithLabelValues(r.Method, r.URL.Path).Observe(duration)
+	httpRequestsTotal.WithLabelValues(r.Method, r.URL.Path, "200").Inc()
+}
+
+// pushAlerts периодически отправляет активные алерты в Alertmanager.
+// Повторная отправка продлевает алерт, а после прекращения аномалий
+// Alertmanager закрывает его по EndsAt.
+func (s *Server) pushAlerts() {
+	ticker := time.NewTicker(s.cfg.Alertmanager.PushInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		alerts, err := s.activeAlerts(context.Background())
+		if err != nil {
+			log.Printf("Failed to build alerts: %v", err)
+			continue
+		}
+
+		if err := notify.PushAlerts(s.cfg.Alertmanager.URL, alerts); err != nil {
+			log.Printf("Failed to push alerts to Alertmanager: %v", err)
+		}
+	}
+}
+
+// attachAnnotations добавляет к каждой аномалии аннотации её устройства
+// (и глобальные), произошедшие в пределах annotations.lookback до неё.
+func (s *Server) attachAnnotations(ctx context.Context, anomalies []models.AnalysisResult) {
+	if len(anomalies) == 0 {
+		return
+	}
+
+	lookback := s.cfg.Annotations.Lookback
+	from, to := anomalies[0].Timestamp, anomalies[0].Timestamp
+	for _, anomaly := range anomalies {
+		if anomaly.Timestamp.Before(from) {
+			from = anomaly.Timestamp
+		}
+		if anomaly.Timestamp.After(to) {
+			to = anomaly.Timestamp
+		}
+	}
+
+	annotations, err := s.cache.GetAnnotations(ctx, from.Add(-lookback), to, "")
+	if err != nil {
+		log.Printf("Failed to load annotations: %v", err)
+		return
+	}
+
+	for i := range anomalies {
+		anomaly := &anomalies[i]
+		for _, annotation := range annotations {
+			if !annotation.AppliesTo(anomaly.Metric.DeviceID) {
+				continue
+			}
+			if annotation.Timestamp.Before(anomaly.Timestamp.Add(-lookback)) || annotation.Timestamp.After(anomaly.Timestamp) {
+				continue
+			}
+			anomaly.Annotations = append(anomaly.Annotations, annotation)
+		}
+	}
+}
+
+func (s *Server) createAnnotationHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	var annotation models.Annotation
+
+	if err := json.NewDecoder(r.Body).Decode(&annotation); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		httpRequestsTotal.WithLabelValues(r.Method, r.URL.Path, "400").Inc()
+		return
+	}
+
+	if annotation.Type == "" || annotation.Title == "" {
+		http.Error(w, "type and title are required", http.StatusBadRequest)
+		httpRequestsTotal.WithLabelValues(r.Method, r.URL.Path, "400").Inc()
+		return
+	}
+
+	if annotation.Timestamp.IsZero() {
+		annotation.Timestamp = time.Now()
+	}
+
+	if err := s.cache.StoreAnnotation(annotation, s.cfg.Annotations.Retention); err != nil {
+		log.Printf("Failed to store annotation: %v", err)
+		http.Error(w, "failed to store annotation", http.StatusInternalServerError)
+		httpRequestsTotal.WithLabelValues(r.Method, r.URL.Path, "500").Inc()
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(annotation)
+
+	duration := time.Since(start).Seconds()
+	requestDuration.WithLabelValues(r.Method, r.URL.Path).Observe(duration)
+	httpRequestsTotal.WithLabelValues(r.Method, r.URL.Path, "201").Inc()
+}
+
+func (s *Server) getAnnotationsHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	from, to, err := parseTimeRange(r, start, 24*time.Hour)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		httpRequestsTotal.WithLabelValues(r.Method, r.URL.Path, "400").Inc()
+		return
+	}
+
+	annotations, err := s.cache.GetAnnotations(r.Context(), from, to, r.URL.Query().Get("device_id"))
+	if err != nil {
+		log.Printf("Failed to load annotations: %v", err)
+		http.Error(w, "failed to load annotations", http.StatusInternalServerError)
+		httpRequestsTotal.WithLabelValues(r.Method, r.URL.Path, "500").Inc()
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(annotations)
+
+	duration := time.Since(start).Seconds()
+	requestDuration.WithLabelValues(r.Method, r.URL.Path).Observe(duration)
+	httpRequestsTotal.WithLabelValues(r.Method, r.URL.Path, "200").Inc()
+}
+
+// analyzerDefaults возвращает глобальные настройки анализа из файла конфигурации.
+func analyzerDefaults(cfg config.AnalyzerConfig) models.AnalyzerSettings {
+	return models.AnalyzerSettings{
+		Detector:     cfg.Detector,
+		Average:      cfg.Average,
+		TrimFraction: cfg.TrimFraction,
+	}
+}
+
+// storedAnalyzerConfig возвращает настройки анализа из файла конфигурации,
+// дополненные изменениями, сохранёнными в Redis через PUT /config/analyzer.
+func (s *Server) storedAnalyzerConfig() (models.AnalyzerConfig, error) {
+	config, err := s.cache.GetAnalyzerConfigOverrides()
+	if err != nil {
+		return config, err
+	}
+	config.Global = analyzerDefaults(s.cfg.Analyzer).Merge(config.Global)
+	return config, nil
+}
+
+// reloadAnalyzerConfig применяет к анализатору настройки, сохранённые в Redis,
+// и публикует действующие настройки для реплик чтения.
+func (s *Server) reloadAnalyzerConfig() error {
+	config, err := s.storedAnalyzerConfig()
+	if err != nil {
+		return err
+	}
+	if err := s.analyzer.SetConfig(config); err != nil {
+		return err
+	}
+	return s.cache.StoreActiveAnalyzerConfig(s.analyzer.Config())
+}
+
+// watchAnalyzerConfig периодически перечитывает настройки анализа, чтобы
+// изменение, принятое другим экземпляром, применялось и здесь.
+func (s *Server) watchAnalyzerConfig() {
+	ticker := time.NewTicker(s.cfg.Analyzer.ConfigPollInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := s.reloadAnalyzerConfig(); err != nil {
+			log.Printf("Failed to reload analyzer config: %v", err)
+		}
+	}
+}
+
+func (s *Server) getAnalyzerConfigHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	analyzerConfig := s.analyzer.Config()
+	if s.cfg.Server.ReadOnly {
+		config, found, err := s.cache.GetActiveAnalyzerConfig()
+		if err != nil {
+			log.Printf("Failed to load analyzer config: %v", err)
+			http.Error(w, "failed to load analyzer config", http.StatusInternalServerError)
+			httpRequestsTotal.WithLabelValues(r.Method, r.URL.Path, "500").Inc()
+			return
+		}
+		if !found {
+			http.Error(w, "analyzer config is not published by a writing instance yet", http.StatusServiceUnavailable)
+			httpRequestsTotal.WithLabelValues(r.Method, r.URL.Path, "503").Inc()
+			return
+		}
+		analyzerConfig = config
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(analyzerConfig)
+
+	duration := time.Since(start).Seconds()
+	requestDuration.WithLabelValues(r.Method, r.URL.Path).Observe(duration)
+	httpRequestsTotal.WithLabelValues(r.Method, r.URL.Path, "200").Inc()
+}
+
+func (s *Server) updateAnalyzerConfigHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	var update models.AnalyzerConfigUpdate
+
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		httpRequestsTotal.WithLabelValues(r.Method, r.URL.Path, "400").Inc()
+		return
+	}
+
+	if err := analytics.ValidateSettings(update.AnalyzerSettings); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		httpRequestsTotal.WithLabelValues(r.Method, r.URL.Path, "400").Inc()
+		return
+	}
+
+	// Сохраняем в Redis: остальные экземпляры применят изменение при
+	// следующем опросе, и оно переживёт перезапуск
+	if err := s.cache.StoreAnalyzerConfigUpdate(update); err != nil {
+		log.Printf("Failed to store analyzer config: %v", err)
+		http.Error(w, "failed to store analyzer config", http.StatusInternalServerError)
+		httpRequestsTotal.WithLabelValues(r.Method, r.URL.Path, "500").Inc()
+		return
+	}
+	if err := s.reloadAnalyzerConfig(); err != nil {
+		log.Printf("Failed to apply analyzer config: %v", err)
+		http.Error(w, "failed to apply analyzer config", http.StatusInternalServerError)
+		httpRequestsTotal.WithLabelValues(r.Method, r.URL.Path, "500").Inc()
+		return
+	}
+
+	log.Printf("Analyzer config updated: device=%q detector=%q average=%q trim_fraction=%v",
+		update.DeviceID, update.Detector, update.Average, update.TrimFraction)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.analyzer.Config())
+
+	duration := time.Since(start).Seconds()
+	requestDuration.WithLabelValues(r.Method, r.URL.Path).Observe(duration)
+	httpRequestsTotal.WithLabelValues(r.Method, r.URL.Path, "200").Inc()
+}
+
+func (s *Server) getUsageHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	query := r.URL.Query()
+
+	to := time.Now().UTC()
+	if v := query.Get("to"); v != "" {
+		t, err := time.Parse(models.UsageDayFormat, v)
+		if err != nil {
+			http.Error(w, "invalid to: expected YYYY-MM-DD", http.StatusBadRequest)
+			httpRequestsTotal.WithLabelValues(r.Method, r.URL.Path, "400").Inc()
+			return
+		}
+		to = t
+	}
+
+	from := to
+	if v := query.Get("from"); v != "" {
+		t, err := time.Parse(models.UsageDayFormat, v)
+		if err != nil {
+			http.Error(w, "invalid from: expected YYYY-MM-DD", http.StatusBadRequest)
+			httpRequestsTotal.WithLabelValues(r.Method, r.URL.Path, "400").Inc()
+			return
+		}
+		from = t
+	}
+
+	if from.After(to) || to.Sub(from) > maxUsageRange {
+		http.Error(w, "from must not be after to and the range must not exceed 366 days", http.StatusBadRequest)
+		httpRequestsTotal.WithLabelValues(r.Method, r.URL.Path, "400").Inc()
+		return
+	}
+
+	records, err := s.cache.GetUsage(r.Context(), from, to, query.Get("tenant"))
+	if err != nil {
+		log.Printf("Failed to load usage: %v", err)
+		http.Error(w, "failed to load usage", http.StatusInternalServerError)
+		httpRequestsTotal.WithLabelValues(r.Method, r.URL.Path, "500").Inc()
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(records)
+
+	duration := time.Since(start).Seconds()
+	requestDuration.WithLabelValues(r.Method, r.URL.Path).Observe(duration)
+	httpRequestsTotal.WithLabelValues(r.Method, r.URL.Path, "200").Inc()
+}
+
+func (s *Server) getMigrationStatusHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	status, err := s.migrator.Status()
+	if err != nil {
+		log.Printf("Failed to get migration status: %v", err)
+		http.Error(w, "failed to get migration status", http.StatusInternalServerError)
+		httpRequestsTotal.WithLabelValues(r.Method, r.URL.Path, "500").Inc()
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+
+	duration := time.Since(start).Seconds()
+	requestDuration.WithLabelValues(r.Method, r.URL.Path).Observe(duration)
+	httpRequestsTotal.WithLabelValues(r.Method, r.URL.Path, "200").Inc()
+}
+
+func (s *Server) startMigrationHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	if err := s.migrator.Start(); err != nil {
+		status, code := http.StatusInternalServerError, "500"
+		if errors.Is(err, cache.ErrMigrationRunning) {
+			status, code = http.StatusConflict, "409"
+		}
+		http.Error(w, err.Error(), status)
+		httpRequestsTotal.WithLabelValues(r.Method, r.URL.Path, code).Inc()
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"status": "started"})
+
+	duration := time.Since(start).Seconds()
+	requestDuration.WithLabelValues(r.Method, r.URL.Path).Observe(duration)
+	httpRequestsTotal.WithLabelValues(r.Method, r.URL.Path, "202").Inc()
+}
+
+// parseTimeRange разбирает параметры from/to (RFC3339). По умолчанию
+// to - now, from - to минус defaultRange.
+func parseTimeRange(r *http.Request, now time.Time, defaultRange time.Duration) (time.Time, time.Time, error) {
+	query := r.URL.Query()
+
+	to := now
+	if v := query.Get("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid to: %w", err)
+		}
+		to = t
+	}
+
+	from := to.Add(-defaultRange)
+	if v := query.Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid from: %w", err)
+		}
+		from = t
+	}
+
+	if from.After(to) {
+		return time.Time{}, time.Time{}, errors.New("from must not be after to")
+	}
+
+	return from, to, nil
+}
+
+func (s *Server) Run() error {
+	addr := ":" + s.cfg.Server.Port
 	srv := &http.Server{
-		Addr:         addr,
-		Handler:      s.router,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 10 * time.Second,
-		IdleTimeout:  30 * time.Second,
+		Addr:              addr,
+		Handler:           s.router,
+		ReadTimeout:       s.cfg.Server.ReadTimeout,
+		ReadHeaderTimeout: s.cfg.Server.ReadHeaderTimeout,
+		WriteTimeout:      s.cfg.Server.WriteTimeout,
+		IdleTimeout:       s.cfg.Server.IdleTimeout,
 	}
 
 	done := make(chan bool, 1)
@@ -200,13 +874,14 @@ func (s *Server) Run(addr string) error {
 		<-quit
 		log.Println("Server is shutting down...")
 
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		ctx, cancel := context.WithTimeout(context.Background(), s.cfg.Server.ShutdownTimeout)
 		defer cancel()
 
 		srv.SetKeepAlivesEnabled(false)
 		if err := srv.Shutdown(ctx); err != nil {
 			log.Fatalf("Could not gracefully shutdown the server: %v", err)
 		}
+		s.usage.Flush()
 		close(done)
 	}()
 
@@ -220,23 +895,55 @@ func (s *Server) Run(addr string) error {
 	return nil
 }
 
+// runMigrations выполняет ожидающие миграции схемы Redis. Сервис при этом
+// может продолжать работать: миграции рассчитаны на выполнение онлайн.
+func runMigrations(cfg config.Config) error {
+	redisClient, err := cache.NewRedisClient(cfg.Redis.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+	defer redisClient.Close()
+
+	migrator := cache.NewMigrator(redisClient)
+	if err := migrator.Run(); err != nil {
+		return err
+	}
+
+	status, err := migrator.Status()
+	if err != nil {
+		return err
+	}
+	log.Printf("Redis schema is at version %d", status.SchemaVersion)
+	return nil
+}
+
 func main() {
-	redisAddr := os.Getenv("REDIS_ADDR")
-	if redisAddr == "" {
-		redisAddr = "localhost:6379"
+	migrate := flag.Bool("migrate", false, "run pending Redis schema migrations and exit")
+	flag.Parse()
+
+	configPath := os.Getenv("CONFIG_PATH")
+	if configPath == "" {
+		configPath = config.DefaultPath
 	}
 
-	server, err := NewServer(redisAddr)
+	cfg, err := config.Load(configPath)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	if *migrate {
+		if err := runMigrations(cfg); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	server, err := NewServer(cfg)
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	if err := server.Run(":" + port); err != nil {
+	if err := server.Run(); err != nil {
 		log.Fatal(err)
 	}
 }
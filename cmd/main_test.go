@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWithTimeout(t *testing.T) {
+	cancelled := make(chan struct{})
+	handler := withTimeout(20*time.Millisecond, func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		close(cancelled)
+	})
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics/series", nil))
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Error("handler context was not cancelled")
+	}
+}
+
+func TestWithTimeoutPassesResponse(t *testing.T) {
+	handler := withTimeout(time.Second, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("ok"))
+	})
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics/series", nil))
+
+	if rec.Code != http.StatusAccepted || rec.Body.String() != "ok" {
+		t.Errorf("response = %d %q, want 202 \"ok\"", rec.Code, rec.Body.String())
+	}
+}
@@ -1,6 +1,8 @@
 package analytics
 
 import (
+	"errors"
+	"fmt"
 	"math"
 	"sync"
 	"time"
@@ -8,61 +10,148 @@ import (
 	"go-service/internal/models"
 )
 
+// Минимальное число точек в окне устройства, после которого детектируются аномалии
+const minSamples = 10
+
+// Во сколько раз отклонение должно превышать порог, чтобы аномалия считалась критической
+const criticalFactor = 2.0
+
+// Как часто искать устройства, переставшие присылать метрики
+const sweepInterval = time.Minute
+
+// deviceState - окно и детектор отдельного устройства с настройками,
+// на которых детектор прогрет, и текущая серия аномалий устройства
+type deviceState struct {
+	window   []models.Metric
+	settings models.AnalyzerSettings
+	detector Detector
+	lastSeen time.Time
+	streak   models.AnomalyStreak
+}
+
 type Analyzer struct {
 	windowSize      int
 	zScoreThreshold float64
-	metricsWindow   []models.Metric
+	deviceIdleTTL   time.Duration
+	maxDevices      int
+	streakGap       time.Duration
+	config          models.AnalyzerConfig
+	devices         map[string]*deviceState
+	lastSweep       time.Time
+	recent          []float64
 	anomalies       []models.AnalysisResult
 	stats           models.AnalyticsStats
 	mu              sync.RWMutex
 }
 
-func NewAnalyzer(windowSize int, zScoreThreshold float64) *Analyzer {
+// NewAnalyzer создаёт анализатор с окном windowSize на каждое устройство.
+// Состояние устройства удаляется, если оно не присылало метрики дольше
+// deviceIdleTTL; одновременно хранится не больше maxDevices устройств.
+// Аномалии устройства с промежутками не больше streakGap образуют серию.
+func NewAnalyzer(windowSize int, zScoreThreshold float64, deviceIdleTTL time.Duration, maxDevices int, streakGap time.Duration) *Analyzer {
 	return &Analyzer{
 		windowSize:      windowSize,
 		zScoreThreshold: zScoreThreshold,
-		metricsWindow:   make([]models.Metric, 0, windowSize),
-		anomalies:       make([]models.AnalysisResult, 0, 100),
+		deviceIdleTTL:   deviceIdleTTL,
+		maxDevices:      maxDevices,
+		streakGap:       streakGap,
+		config: models.AnalyzerConfig{
+			Global: models.AnalyzerSettings{
+				Detector:     DetectorZScore,
+				Average:      AverageMean,
+				TrimFraction: defaultTrimFraction,
+			},
+			Devices: make(map[string]models.AnalyzerSettings),
+		},
+		devices:   make(map[string]*deviceState),
+		anomalies: make([]models.AnalysisResult, 0, 100),
 		stats: models.AnalyticsStats{
 			WindowSize:      windowSize,
 			ZScoreThreshold: zScoreThreshold,
+			Detector:        DetectorZScore,
 		},
 	}
 }
 
 func (a *Analyzer) Analyze(metric models.Metric) models.AnalysisResult {
+	start := time.Now()
+	defer func() {
+		analysisDuration.Observe(time.Since(start).Seconds())
+	}()
+
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	// Добавляем метрику в окно
-	a.metricsWindow = append(a.metricsWindow, metric)
-	if len(a.metricsWindow) > a.windowSize {
-		a.metricsWindow = a.metricsWindow[1:]
+	a.evictIdleDevices(start)
+
+	state, ok := a.devices[metric.DeviceID]
+	if !ok {
+		if len(a.devices) >= a.maxDevices {
+			a.evictLeastRecent()
+		}
+		settings := a.settingsFor(metric.DeviceID)
+		state = &deviceState{settings: settings, detector: a.newDetector(settings, nil)}
+		a.devices[metric.DeviceID] = state
+		devicesTracked.Set(float64(len(a.devices)))
 	}
+	state.lastSeen = start
 
-	// Вычисляем скользящее среднее
-	rollingAvg := a.calculateRollingAverage()
+	// Настройки сменились после прогрева детектора
+	if settings := a.settingsFor(metric.DeviceID); state.settings != settings {
+		state.settings = settings
+		state.detector = a.newDetector(settings, state.window)
+	}
 
-	// Вычисляем Z-score
-	zScore := a.calculateZScore(metric.RPS, rollingAvg)
+	// Добавляем метрику в окно устройства
+	state.window = append(state.window, metric)
+	if len(state.window) > a.windowSize {
+		state.window = state.window[1:]
+	}
+	windowFill.Observe(float64(len(state.window)) / float64(a.windowSize))
+
+	// Вычисляем скользящее среднее и Z-score
+	baseline := newBaseline(state.window, state.settings)
+	zScore := zScoreDetector{}.Score(metric.RPS, baseline)
+
+	// Оцениваем значение активным детектором
+	score := state.detector.Score(metric.RPS, baseline)
+	detectorEvaluations.WithLabelValues(state.detector.Name()).Inc()
 
 	// Определяем аномалию
-	isAnomaly := math.Abs(zScore) > a.zScoreThreshold && len(a.metricsWindow) >= 10
+	exceeded := math.Abs(score) > a.zScoreThreshold
+	isAnomaly := exceeded && len(state.window) >= minSamples
+	if exceeded && !isAnomaly {
+		anomaliesSuppressed.WithLabelValues("warmup").Inc()
+	}
 
 	result := models.AnalysisResult{
 		Timestamp:      time.Now(),
 		Metric:         metric,
-		RollingAverage: rollingAvg,
+		RollingAverage: baseline.Mean,
 		ZScore:         zScore,
+		Detector:       state.detector.Name(),
+		Score:          score,
 		IsAnomaly:      isAnomaly,
 	}
+	if !metric.ReceivedAt.IsZero() {
+		result.PipelineLatencyMs = float64(time.Since(metric.ReceivedAt)) / float64(time.Millisecond)
+	}
 
-	// Обновляем статистику
+	// Обновляем общую статистику: скользящее среднее считается по последним
+	// метрикам всех устройств, а не по окну устройства, приславшего метрику
+	a.recent = append(a.recent, metric.RPS)
+	if len(a.recent) > a.windowSize {
+		a.recent = a.recent[1:]
+	}
 	a.stats.CurrentRPS = metric.RPS
-	a.stats.RollingAverage = rollingAvg
+	a.stats.RollingAverage = calculateRollingAverage(a.recent)
 	a.stats.TotalMetrics++
 
 	if isAnomaly {
+		result.Severity = a.severity(score)
+		anomaliesBySeverity.WithLabelValues(result.Severity).Inc()
+		result.Streak = state.extendStreak(result, a.streakGap)
+
 		a.stats.TotalAnomalies++
 		a.stats.LastAnomalyTime = time.Now()
 		a.stats.AnomalyRate = float64(a.stats.TotalAnomalies) / float64(a.stats.TotalMetrics)
@@ -77,37 +166,192 @@ func (a *Analyzer) Analyze(metric models.Metric) models.AnalysisResult {
 	return result
 }
 
-func (a *Analyzer) calculateRollingAverage() float64 {
-	if len(a.metricsWindow) == 0 {
+// extendStreak добавляет аномалию в серию устройства или начинает новую,
+// если предыдущая аномалия была раньше чем за gap. Серия ведётся по
+// устройству, поэтому её начало и исходная критичность не зависят от того,
+// сколько аномалий других устройств помещается в общий список.
+func (s *deviceState) extendStreak(result models.AnalysisResult, gap time.Duration) *models.AnomalyStreak {
+	if s.streak.Count == 0 || result.Timestamp.Sub(s.streak.LastAt) > gap {
+		s.streak = models.AnomalyStreak{
+			StartedAt:   result.Timestamp,
+			Severity:    result.Severity,
+			MaxSeverity: result.Severity,
+		}
+	}
+
+	s.streak.LastAt = result.Timestamp
+	s.streak.Count++
+	if result.Severity == models.SeverityCritical {
+		s.streak.MaxSeverity = models.SeverityCritical
+	}
+
+	streak := s.streak
+	return &streak
+}
+
+// evictIdleDevices удаляет состояние устройств, не присылавших метрики
+// дольше deviceIdleTTL. Проверка выполняется не чаще раза в sweepInterval.
+func (a *Analyzer) evictIdleDevices(now time.Time) {
+	if now.Sub(a.lastSweep) < sweepInterval {
+		return
+	}
+	a.lastSweep = now
+
+	for deviceID, state := range a.devices {
+		if now.Sub(state.lastSeen) > a.deviceIdleTTL {
+			a.removeDevice(deviceID, "idle")
+		}
+	}
+}
+
+// evictLeastRecent освобождает место для нового устройства, удаляя
+// устройство, дольше всех не присылавшее метрики.
+func (a *Analyzer) evictLeastRecent() {
+	var oldestID string
+	var oldest time.Time
+	for deviceID, state := range a.devices {
+		if oldestID == "" || state.lastSeen.Before(oldest) {
+			oldestID, oldest = deviceID, state.lastSeen
+		}
+	}
+	if oldestID != "" {
+		a.removeDevice(oldestID, "limit")
+	}
+}
+
+func (a *Analyzer) removeDevice(deviceID, reason string) {
+	delete(a.devices, deviceID)
+	devicesTracked.Set(float64(len(a.devices)))
+	devicesEvicted.WithLabelValues(reason).Inc()
+}
+
+func (a *Analyzer) severity(score float64) string {
+	if math.Abs(score) >= a.zScoreThreshold*criticalFactor {
+		return models.SeverityCritical
+	}
+	return models.SeverityWarning
+}
+
+// Config возвращает текущие настройки анализа.
+func (a *Analyzer) Config() models.AnalyzerConfig {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	config := models.AnalyzerConfig{
+		Global:  a.config.Global,
+		Devices: make(map[string]models.AnalyzerSettings, len(a.config.Devices)),
+	}
+	for deviceID, settings := range a.config.Devices {
+		config.Devices[deviceID] = settings
+	}
+
+	return config
+}
+
+// ValidateSettings проверяет детектор и способ усреднения; пустые поля допустимы.
+func ValidateSettings(settings models.AnalyzerSettings) error {
+	if settings.Detector != "" {
+		if _, err := NewDetector(settings.Detector, 0); err != nil {
+			return err
+		}
+	}
+	return validateAverage(settings.Average, settings.TrimFraction)
+}
+
+// SetConfig заменяет настройки анализа без перезапуска. Устройство, у которого
+// сменились действующие настройки, получает новый детектор при следующей
+// метрике: детектор прогревается на текущем окне с новыми настройками,
+// поэтому окно не теряется, а состояние детектора (например, суммы CUSUM)
+// соответствует новому способу усреднения. Прогрев по одному устройству
+// не задерживает приём метрик остальных.
+func (a *Analyzer) SetConfig(config models.AnalyzerConfig) error {
+	if config.Global.Detector == "" {
+		return errors.New("global detector is required")
+	}
+	if err := ValidateSettings(config.Global); err != nil {
+		return err
+	}
+
+	devices := make(map[string]models.AnalyzerSettings, len(config.Devices))
+	for deviceID, settings := range config.Devices {
+		if err := ValidateSettings(settings); err != nil {
+			return fmt.Errorf("device %s: %w", deviceID, err)
+		}
+		devices[deviceID] = settings
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.config = models.AnalyzerConfig{Global: config.Global, Devices: devices}
+	a.stats.Detector = config.Global.Detector
+
+	return nil
+}
+
+// settingsFor возвращает действующие настройки устройства: глобальные,
+// дополненные переопределениями устройства.
+func (a *Analyzer) settingsFor(deviceID string) models.AnalyzerSettings {
+	return a.config.Global.Merge(a.config.Devices[deviceID])
+}
+
+// newDetector создаёт детектор и прогревает его, прогоняя накопленное окно
+// так, как если бы детектор работал с самого начала.
+func (a *Analyzer) newDetector(settings models.AnalyzerSettings, window []models.Metric) Detector {
+	detector, err := NewDetector(settings.Detector, a.zScoreThreshold)
+	if err != nil {
+		// Имена проверяются в SetConfig
+		panic(err)
+	}
+
+	for i, metric := range window {
+		detector.Score(metric.RPS, newBaseline(window[:i+1], settings))
+	}
+
+	return detector
+}
+
+// newBaseline считает среднее окна выбранным способом усреднения.
+// σ и Values всегда считаются по исходным значениям окна: σ усечённой
+// выборки занижен и завышал бы оценки детекторов.
+func newBaseline(window []models.Metric, settings models.AnalyzerSettings) Baseline {
+	values := make([]float64, len(window))
+	for i, metric := range window {
+		values[i] = metric.RPS
+	}
+
+	return Baseline{
+		Mean:   calculateRollingAverage(averagingSample(values, settings.Average, settings.TrimFraction)),
+		StdDev: calculateStdDev(values, calculateRollingAverage(values)),
+		Values: values,
+	}
+}
+
+func calculateRollingAverage(values []float64) float64 {
+	if len(values) == 0 {
 		return 0
 	}
 
 	var sum float64
-	for _, metric := range a.metricsWindow {
-		sum += metric.RPS
+	for _, v := range values {
+		sum += v
 	}
 
-	return sum / float64(len(a.metricsWindow))
+	return sum / float64(len(values))
 }
 
-func (a *Analyzer) calculateZScore(value, mean float64) float64 {
-	if len(a.metricsWindow) < 2 {
+func calculateStdDev(values []float64, mean float64) float64 {
+	if len(values) < 2 {
 		return 0
 	}
 
-	// Вычисляем стандартное отклонение
 	var variance float64
-	for _, metric := range a.metricsWindow {
-		diff := metric.RPS - mean
+	for _, v := range values {
+		diff := v - mean
 		variance += diff * diff
 	}
 
-	stdDev := math.Sqrt(variance / float64(len(a.metricsWindow)-1))
-	if stdDev == 0 {
-		return 0
-	}
-
-	return (value - mean) / stdDev
+	return math.Sqrt(variance / float64(len(values)-1))
 }
 
 func (a *Analyzer) GetCurrentStats() models.AnalyticsStats {
@@ -129,5 +373,9 @@ func (a *Analyzer) GetRecentAnomalies(limit int) []models.AnalysisResult {
 		start = 0
 	}
 
-	return a.anomalies[start:]
+	// Возвращаем копию, чтобы вызывающий код не разделял срез с анализатором
+	result := make([]models.AnalysisResult, len(a.anomalies)-start)
+	copy(result, a.anomalies[start:])
+
+	return result
 }
@@ -0,0 +1,153 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"go-service/internal/models"
+)
+
+func TestSetConfigRewarmsLazilyOnAnySettingChange(t *testing.T) {
+	a := NewAnalyzer(50, 2, time.Hour, 100, time.Minute)
+	config := models.AnalyzerConfig{
+		Global: models.AnalyzerSettings{Detector: DetectorCUSUM, Average: AverageMean, TrimFraction: 0.1},
+	}
+	if err := a.SetConfig(config); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 20; i++ {
+		a.Analyze(models.Metric{DeviceID: "device-1", RPS: float64(100 + i%3)})
+	}
+	detector := a.devices["device-1"].detector
+
+	// Смена только способа усреднения тоже пересоздаёт детектор,
+	// но не сразу, а при следующей метрике устройства
+	config.Global.Average = AverageTrimmed
+	if err := a.SetConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	if a.devices["device-1"].detector != detector {
+		t.Fatal("detector was re-warmed before the next metric")
+	}
+
+	a.Analyze(models.Metric{DeviceID: "device-1", RPS: 101})
+
+	state := a.devices["device-1"]
+	if state.detector == detector {
+		t.Error("detector was not re-warmed after average change")
+	}
+	if state.settings.Average != AverageTrimmed || state.settings.Detector != DetectorCUSUM {
+		t.Errorf("device settings = %+v", state.settings)
+	}
+}
+
+func TestSetConfigValidates(t *testing.T) {
+	a := NewAnalyzer(50, 2, time.Hour, 100, time.Minute)
+
+	tests := []struct {
+		name   string
+		config models.AnalyzerConfig
+	}{
+		{"missing global detector", models.AnalyzerConfig{}},
+		{"unknown global detector", models.AnalyzerConfig{Global: models.AnalyzerSettings{Detector: "magic"}}},
+		{"unknown device average", models.AnalyzerConfig{
+			Global:  models.AnalyzerSettings{Detector: DetectorZScore},
+			Devices: map[string]models.AnalyzerSettings{"device-1": {Average: "median"}},
+		}},
+	}
+
+	for _, tt := range tests {
+		if err := a.SetConfig(tt.config); err == nil {
+			t.Errorf("%s: expected error", tt.name)
+		}
+	}
+
+	// Неверные настройки не применяются
+	if got := a.Config().Global.Detector; got != DetectorZScore {
+		t.Errorf("global detector = %q, want %q", got, DetectorZScore)
+	}
+}
+
+func TestSettingsForMergesDeviceOverrides(t *testing.T) {
+	a := NewAnalyzer(50, 2, time.Hour, 100, time.Minute)
+	err := a.SetConfig(models.AnalyzerConfig{
+		Global:  models.AnalyzerSettings{Detector: DetectorZScore, Average: AverageMean, TrimFraction: 0.1},
+		Devices: map[string]models.AnalyzerSettings{"device-1": {Detector: DetectorEWMA, TrimFraction: 0.2}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := models.AnalyzerSettings{Detector: DetectorEWMA, Average: AverageMean, TrimFraction: 0.2}
+	if got := a.settingsFor("device-1"); got != want {
+		t.Errorf("settingsFor(device-1) = %+v, want %+v", got, want)
+	}
+	if got := a.settingsFor("device-2"); got.Detector != DetectorZScore {
+		t.Errorf("settingsFor(device-2) = %+v, want global settings", got)
+	}
+}
+
+func TestStatsRollingAverageAcrossDevices(t *testing.T) {
+	a := NewAnalyzer(4, 2, time.Hour, 100, time.Minute)
+
+	a.Analyze(models.Metric{DeviceID: "device-1", RPS: 100})
+	a.Analyze(models.Metric{DeviceID: "device-1", RPS: 100})
+	a.Analyze(models.Metric{DeviceID: "device-2", RPS: 10})
+	result := a.Analyze(models.Metric{DeviceID: "device-2", RPS: 10})
+
+	// Базовая линия анализа - окно устройства
+	if result.RollingAverage != 10 {
+		t.Errorf("result RollingAverage = %v, want 10", result.RollingAverage)
+	}
+	// Общая статистика - по последним метрикам всех устройств
+	if got := a.GetCurrentStats().RollingAverage; got != 55 {
+		t.Errorf("stats RollingAverage = %v, want 55", got)
+	}
+
+	a.Analyze(models.Metric{DeviceID: "device-2", RPS: 10})
+	if got := a.GetCurrentStats().RollingAverage; got != 32.5 {
+		t.Errorf("stats RollingAverage after window shift = %v, want 32.5", got)
+	}
+}
+
+func TestStreakTrackedPerDevice(t *testing.T) {
+	a := NewAnalyzer(50, 2, time.Hour, 100, time.Hour)
+	for i := 0; i < 20; i++ {
+		a.Analyze(models.Metric{DeviceID: "device-1", RPS: float64(100 + i%3)})
+		a.Analyze(models.Metric{DeviceID: "device-2", RPS: float64(100 + i%3)})
+	}
+
+	first := a.Analyze(models.Metric{DeviceID: "device-1", RPS: 1000})
+	if !first.IsAnomaly || first.Streak == nil {
+		t.Fatalf("first result = %+v, want anomaly with streak", first)
+	}
+
+	// Аномалия другого устройства начинает свою серию
+	other := a.Analyze(models.Metric{DeviceID: "device-2", RPS: 1000})
+	if other.Streak == nil || other.Streak.Count != 1 || !other.Streak.StartedAt.Equal(other.Timestamp) {
+		t.Errorf("device-2 streak = %+v, want new streak", other.Streak)
+	}
+
+	next := a.Analyze(models.Metric{DeviceID: "device-1", RPS: 1000})
+	if !next.IsAnomaly {
+		t.Fatalf("next result = %+v, want anomaly", next)
+	}
+	streak := next.Streak
+	if streak.Count != 2 || !streak.StartedAt.Equal(first.Timestamp) || !streak.LastAt.Equal(next.Timestamp) {
+		t.Errorf("device-1 streak = %+v, want continued from %v", streak, first.Timestamp)
+	}
+	if streak.Severity != first.Severity {
+		t.Errorf("streak severity = %q, want first anomaly severity %q", streak.Severity, first.Severity)
+	}
+
+	// Промежуток больше streakGap начинает новую серию
+	a.streakGap = 0
+	later := a.Analyze(models.Metric{DeviceID: "device-1", RPS: 1000})
+	if !later.IsAnomaly {
+		t.Fatalf("later result = %+v, want anomaly", later)
+	}
+	if later.Streak.Count != 1 || !later.Streak.StartedAt.Equal(later.Timestamp) {
+		t.Errorf("streak after gap = %+v, want new streak", later.Streak)
+	}
+}
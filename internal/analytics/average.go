@@ -0,0 +1,55 @@
+package analytics
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Способы расчёта скользящего среднего
+const (
+	AverageMean       = "mean"
+	AverageTrimmed    = "trimmed"
+	AverageWinsorized = "winsorized"
+)
+
+const defaultTrimFraction = 0.1
+
+func validateAverage(average string, trimFraction float64) error {
+	switch average {
+	case "", AverageMean, AverageTrimmed, AverageWinsorized:
+	default:
+		return fmt.Errorf("unknown average %q", average)
+	}
+
+	if trimFraction < 0 || trimFraction >= 0.5 {
+		return fmt.Errorf("trim_fraction must be in [0, 0.5), got %v", trimFraction)
+	}
+
+	return nil
+}
+
+// averagingSample возвращает выборку, по которой считается среднее окна.
+// Усечённое среднее отбрасывает долю trimFraction крайних значений с каждой
+// стороны, винзоризованное заменяет их ближайшими оставшимися значениями.
+// Так единичный выброс не сдвигает базовую линию и не вызывает каскад
+// последующих аномалий.
+func averagingSample(values []float64, average string, trimFraction float64) []float64 {
+	k := int(float64(len(values)) * trimFraction)
+	if average == "" || average == AverageMean || k == 0 {
+		return values
+	}
+
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+
+	if average == AverageTrimmed {
+		return sorted[k : n-k]
+	}
+
+	for i := 0; i < k; i++ {
+		sorted[i] = sorted[k]
+		sorted[n-1-i] = sorted[n-1-k]
+	}
+	return sorted
+}
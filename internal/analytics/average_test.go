@@ -0,0 +1,101 @@
+package analytics
+
+import (
+	"testing"
+
+	"go-service/internal/models"
+)
+
+func TestValidateAverage(t *testing.T) {
+	tests := []struct {
+		average      string
+		trimFraction float64
+		wantErr      bool
+	}{
+		{"", 0, false},
+		{AverageMean, 0.1, false},
+		{AverageTrimmed, 0.2, false},
+		{AverageWinsorized, 0, false},
+		{"median", 0.1, true},
+		{AverageTrimmed, -0.1, true},
+		{AverageTrimmed, 0.5, true},
+	}
+
+	for _, tt := range tests {
+		err := validateAverage(tt.average, tt.trimFraction)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("validateAverage(%q, %v) error = %v, wantErr %v", tt.average, tt.trimFraction, err, tt.wantErr)
+		}
+	}
+}
+
+func TestAveragingSample(t *testing.T) {
+	values := []float64{5, 1, 100, 3, 2, 4, 6, 8, 7, -50}
+
+	tests := []struct {
+		name         string
+		average      string
+		trimFraction float64
+		want         []float64
+	}{
+		{"mean keeps window", AverageMean, 0.1, values},
+		{"empty means mean", "", 0.1, values},
+		{"trimmed", AverageTrimmed, 0.1, []float64{1, 2, 3, 4, 5, 6, 7, 8}},
+		{"trimmed two per side", AverageTrimmed, 0.2, []float64{2, 3, 4, 5, 6, 7}},
+		{"winsorized", AverageWinsorized, 0.1, []float64{1, 1, 2, 3, 4, 5, 6, 7, 8, 8}},
+		{"fraction below one value", AverageTrimmed, 0.05, values},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := averagingSample(values, tt.average, tt.trimFraction)
+			if len(got) != len(tt.want) {
+				t.Fatalf("averagingSample = %v, want %v", got, tt.want)
+			}
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Fatalf("averagingSample = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+
+	if values[0] != 5 || values[9] != -50 {
+		t.Errorf("averagingSample modified input: %v", values)
+	}
+}
+
+func TestNewBaseline(t *testing.T) {
+	rps := []float64{5, 1, 100, 3, 2, 4, 6, 8, 7, -50}
+	window := make([]models.Metric, len(rps))
+	for i, v := range rps {
+		window[i] = models.Metric{RPS: v}
+	}
+
+	full := newBaseline(window, models.AnalyzerSettings{Average: AverageMean})
+	if !approxEqual(full.Mean, 8.6) {
+		t.Errorf("mean Mean = %v, want 8.6", full.Mean)
+	}
+
+	tests := []struct {
+		average  string
+		wantMean float64
+	}{
+		{AverageTrimmed, 4.5},
+		{AverageWinsorized, 4.5},
+	}
+
+	for _, tt := range tests {
+		baseline := newBaseline(window, models.AnalyzerSettings{Average: tt.average, TrimFraction: 0.1})
+		if !approxEqual(baseline.Mean, tt.wantMean) {
+			t.Errorf("%s Mean = %v, want %v", tt.average, baseline.Mean, tt.wantMean)
+		}
+		// σ считается по всему окну независимо от способа усреднения
+		if !approxEqual(baseline.StdDev, full.StdDev) {
+			t.Errorf("%s StdDev = %v, want %v", tt.average, baseline.StdDev, full.StdDev)
+		}
+		if len(baseline.Values) != len(rps) {
+			t.Errorf("%s Values has %d values, want %d", tt.average, len(baseline.Values), len(rps))
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package analytics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Поддерживаемые детекторы аномалий
+const (
+	DetectorZScore   = "zscore"
+	DetectorEWMA     = "ewma"
+	DetectorQuantile = "quantile"
+	DetectorCUSUM    = "cusum"
+)
+
+const (
+	// Коэффициент сглаживания EWMA
+	ewmaAlpha = 0.3
+	// Допуск CUSUM в единицах стандартного отклонения
+	cusumSlack = 0.5
+	// Отношение межквартильного размаха к σ нормального распределения
+	iqrToSigma = 1.349
+)
+
+// Baseline - статистика окна устройства, на которую опираются детекторы.
+type Baseline struct {
+	Mean   float64
+	StdDev float64
+	Values []float64
+}
+
+// Detector оценивает очередное значение метрики. Оценка выражена в тех же
+// единицах, что и порог анализатора: |score| > threshold означает аномалию.
+// Детекторы с собственным состоянием (EWMA, CUSUM) обновляют его при каждом вызове.
+type Detector interface {
+	Name() string
+	Score(value float64, baseline Baseline) float64
+}
+
+func NewDetector(name string, threshold float64) (Detector, error) {
+	switch name {
+	case DetectorZScore:
+		return zScoreDetector{}, nil
+	case DetectorEWMA:
+		return &ewmaDetector{}, nil
+	case DetectorQuantile:
+		return quantileDetector{}, nil
+	case DetectorCUSUM:
+		return &cusumDetector{threshold: threshold}, nil
+	default:
+		return nil, fmt.Errorf("unknown detector %q", name)
+	}
+}
+
+// zScoreDetector - отклонение от скользящего среднего в σ окна.
+type zScoreDetector struct{}
+
+func (zScoreDetector) Name() string { return DetectorZScore }
+
+func (zScoreDetector) Score(value float64, baseline Baseline) float64 {
+	if baseline.StdDev == 0 {
+		return 0
+	}
+	return (value - baseline.Mean) / baseline.StdDev
+}
+
+// ewmaDetector - отклонение от экспоненциально взвешенного среднего
+// в единицах экспоненциально взвешенного σ.
+type ewmaDetector struct {
+	mean        float64
+	variance    float64
+	initialized bool
+}
+
+func (d *ewmaDetector) Name() string { return DetectorEWMA }
+
+func (d *ewmaDetector) Score(value float64, _ Baseline) float64 {
+	if !d.initialized {
+		d.mean = value
+		d.initialized = true
+		return 0
+	}
+
+	diff := value - d.mean
+	var score float64
+	if stdDev := math.Sqrt(d.variance); stdDev > 0 {
+		score = diff / stdDev
+	}
+
+	d.mean += ewmaAlpha * diff
+	d.variance = (1 - ewmaAlpha) * (d.variance + ewmaAlpha*diff*diff)
+
+	return score
+}
+
+// quantileDetector - робастный z-score на основе медианы и межквартильного размаха,
+// устойчивый к выбросам внутри окна.
+type quantileDetector struct{}
+
+func (quantileDetector) Name() string { return DetectorQuantile }
+
+func (quantileDetector) Score(value float64, baseline Baseline) float64 {
+	if len(baseline.Values) < 2 {
+		return 0
+	}
+
+	sorted := append([]float64(nil), baseline.Values...)
+	sort.Float64s(sorted)
+
+	iqr := quantile(sorted, 0.75) - quantile(sorted, 0.25)
+	if iqr == 0 {
+		return 0
+	}
+
+	return (value - quantile(sorted, 0.5)) / (iqr / iqrToSigma)
+}
+
+// quantile возвращает квантиль q отсортированного среза с линейной интерполяцией.
+func quantile(sorted []float64, q float64) float64 {
+	pos := q * float64(len(sorted)-1)
+	lower := int(math.Floor(pos))
+	upper := int(math.Ceil(pos))
+	frac := pos - float64(lower)
+	return sorted[lower] + (sorted[upper]-sorted[lower])*frac
+}
+
+// cusumDetector - двусторонняя кумулятивная сумма стандартизованных отклонений.
+// Реагирует на устойчивый сдвиг уровня, который z-score пропускает.
+// После срабатывания суммы сбрасываются.
+type cusumDetector struct {
+	threshold float64
+	high      float64
+	low       float64
+}
+
+func (d *cusumDetector) Name() string { return DetectorCUSUM }
+
+func (d *cusumDetector) Score(value float64, baseline Baseline) float64 {
+	if baseline.StdDev == 0 {
+		return 0
+	}
+
+	z := (value - baseline.Mean) / baseline.StdDev
+	d.high = math.Max(0, d.high+z-cusumSlack)
+	d.low = math.Min(0, d.low+z+cusumSlack)
+
+	score := d.high
+	if -d.low > d.high {
+		score = d.low
+	}
+
+	if math.Abs(score) > d.threshold {
+		d.high, d.low = 0, 0
+	}
+
+	return score
+}
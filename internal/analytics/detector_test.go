@@ -0,0 +1,134 @@
+package analytics
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNewDetector(t *testing.T) {
+	for _, name := range []string{DetectorZScore, DetectorEWMA, DetectorQuantile, DetectorCUSUM} {
+		detector, err := NewDetector(name, 2)
+		if err != nil {
+			t.Fatalf("NewDetector(%q): %v", name, err)
+		}
+		if detector.Name() != name {
+			t.Errorf("NewDetector(%q).Name() = %q", name, detector.Name())
+		}
+	}
+
+	if _, err := NewDetector("unknown", 2); err == nil {
+		t.Error("NewDetector(unknown): expected error")
+	}
+}
+
+func TestZScoreDetector(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    float64
+		baseline Baseline
+		want     float64
+	}{
+		{"above mean", 130, Baseline{Mean: 100, StdDev: 10}, 3},
+		{"below mean", 85, Baseline{Mean: 100, StdDev: 10}, -1.5},
+		{"zero stddev", 500, Baseline{Mean: 100}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (zScoreDetector{}).Score(tt.value, tt.baseline); !approxEqual(got, tt.want) {
+				t.Errorf("Score = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuantileDetector(t *testing.T) {
+	// Выброс внутри окна не меняет медиану и межквартильный размах
+	values := []float64{10, 11, 12, 13, 14, 1000}
+	baseline := Baseline{Values: values}
+
+	// Медиана 12.5, IQR 13.75-11.25 = 2.5
+	want := (15 - 12.5) / (2.5 / iqrToSigma)
+	if got := (quantileDetector{}).Score(15, baseline); !approxEqual(got, want) {
+		t.Errorf("Score = %v, want %v", got, want)
+	}
+
+	if got := (quantileDetector{}).Score(15, Baseline{Values: []float64{5, 5, 5, 5}}); got != 0 {
+		t.Errorf("Score with zero IQR = %v, want 0", got)
+	}
+	if got := (quantileDetector{}).Score(15, Baseline{Values: []float64{5}}); got != 0 {
+		t.Errorf("Score with single value = %v, want 0", got)
+	}
+}
+
+func TestQuantile(t *testing.T) {
+	sorted := []float64{1, 2, 3, 4, 5}
+	tests := []struct {
+		q    float64
+		want float64
+	}{
+		{0, 1},
+		{0.25, 2},
+		{0.5, 3},
+		{0.6, 3.4},
+		{1, 5},
+	}
+
+	for _, tt := range tests {
+		if got := quantile(sorted, tt.q); !approxEqual(got, tt.want) {
+			t.Errorf("quantile(%v) = %v, want %v", tt.q, got, tt.want)
+		}
+	}
+}
+
+func TestEWMADetector(t *testing.T) {
+	detector := &ewmaDetector{}
+
+	// Первое значение только инициализирует среднее
+	if got := detector.Score(100, Baseline{}); got != 0 {
+		t.Errorf("first Score = %v, want 0", got)
+	}
+	// Дисперсия ещё нулевая
+	if got := detector.Score(110, Baseline{}); got != 0 {
+		t.Errorf("second Score = %v, want 0", got)
+	}
+
+	for i := 0; i < 20; i++ {
+		detector.Score(100+float64(i%2)*10, Baseline{})
+	}
+	if got := detector.Score(200, Baseline{}); got <= 2 {
+		t.Errorf("Score after spike = %v, want > 2", got)
+	}
+}
+
+func TestCUSUMDetector(t *testing.T) {
+	detector := &cusumDetector{threshold: 4}
+	baseline := Baseline{Mean: 100, StdDev: 10}
+
+	// Устойчивый сдвиг на 1.5σ накапливается по 1σ за шаг
+	// (с учётом допуска cusumSlack) и срабатывает на пятом значении
+	for i, want := range []float64{1, 2, 3, 4, 5} {
+		if got := detector.Score(115, baseline); !approxEqual(got, want) {
+			t.Fatalf("step %d: Score = %v, want %v", i, got, want)
+		}
+	}
+
+	// После срабатывания суммы сброшены
+	if got := detector.Score(115, baseline); !approxEqual(got, 1) {
+		t.Errorf("Score after reset = %v, want 1", got)
+	}
+
+	// Сдвиг вниз даёт отрицательную оценку
+	detector = &cusumDetector{threshold: 4}
+	if got := detector.Score(80, baseline); !approxEqual(got, -1.5) {
+		t.Errorf("Score below mean = %v, want -1.5", got)
+	}
+
+	if got := detector.Score(200, Baseline{Mean: 100}); got != 0 {
+		t.Errorf("Score with zero stddev = %v, want 0", got)
+	}
+}
+
+func approxEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
@@ -0,0 +1,48 @@
+package analytics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Метрики самого анализатора
+var (
+	// Распределение вместо метки device_id: число устройств задаётся входными
+	// данными и не должно определять число рядов Prometheus
+	windowFill = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "analyzer_window_fill_ratio",
+		Help:    "Fill level of the device analysis window at each evaluation (0..1)",
+		Buckets: prometheus.LinearBuckets(0.1, 0.1, 10),
+	})
+
+	devicesTracked = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "analyzer_devices_tracked",
+		Help: "Number of devices with analysis state",
+	})
+
+	devicesEvicted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "analyzer_devices_evicted_total",
+		Help: "Total number of devices whose analysis state was dropped",
+	}, []string{"reason"})
+
+	analysisDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "analyzer_analysis_duration_seconds",
+		Help:    "Duration of a single metric analysis",
+		Buckets: prometheus.ExponentialBuckets(0.00001, 2, 15),
+	})
+
+	detectorEvaluations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "analyzer_detector_evaluations_total",
+		Help: "Total number of anomaly detector evaluations",
+	}, []string{"detector"})
+
+	anomaliesSuppressed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "analyzer_anomalies_suppressed_total",
+		Help: "Total number of threshold breaches not reported as anomalies",
+	}, []string{"reason"})
+
+	anomaliesBySeverity = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "analyzer_anomalies_total",
+		Help: "Total number of anomalies by severity",
+	}, []string{"severity"})
+)
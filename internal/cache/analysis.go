@@ -0,0 +1,84 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"go-service/internal/models"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Состояние анализа, которое пишущий экземпляр публикует для реплик чтения
+const (
+	statsKey     = "analytics:stats"
+	anomaliesKey = "analytics:anomalies"
+	// Столько же аномалий хранит в памяти анализатор
+	maxStoredAnomalies = 100
+)
+
+// StoreAnalysis сохраняет текущую статистику и, если результат является
+// аномалией, добавляет его в список последних аномалий.
+func (r *RedisClient) StoreAnalysis(stats models.AnalyticsStats, result models.AnalysisResult) error {
+	statsData, err := json.Marshal(stats)
+	if err != nil {
+		return fmt.Errorf("failed to marshal stats: %w", err)
+	}
+
+	_, err = r.client.Pipelined(r.ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(r.ctx, statsKey, statsData, 0)
+
+		if result.IsAnomaly {
+			data, err := json.Marshal(result)
+			if err != nil {
+				return fmt.Errorf("failed to marshal anomaly: %w", err)
+			}
+			pipe.LPush(r.ctx, anomaliesKey, data)
+			pipe.LTrim(r.ctx, anomaliesKey, 0, maxStoredAnomalies-1)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store analysis: %w", err)
+	}
+
+	return nil
+}
+
+func (r *RedisClient) GetStats() (models.AnalyticsStats, error) {
+	var stats models.AnalyticsStats
+
+	data, err := r.reader().Get(r.ctx, statsKey).Bytes()
+	if err == redis.Nil {
+		return stats, nil
+	}
+	if err != nil {
+		return stats, fmt.Errorf("failed to get stats: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &stats); err != nil {
+		return stats, fmt.Errorf("failed to unmarshal stats: %w", err)
+	}
+
+	return stats, nil
+}
+
+// GetRecentAnomalies возвращает последние limit аномалий, от старых к новым,
+// как и Analyzer.GetRecentAnomalies.
+func (r *RedisClient) GetRecentAnomalies(limit int64) ([]models.AnalysisResult, error) {
+	items, err := r.reader().LRange(r.ctx, anomaliesKey, 0, limit-1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get anomalies: %w", err)
+	}
+
+	anomalies := make([]models.AnalysisResult, 0, len(items))
+	for i := len(items) - 1; i >= 0; i-- {
+		var anomaly models.AnalysisResult
+		if err := json.Unmarshal([]byte(items[i]), &anomaly); err != nil {
+			continue
+		}
+		anomalies = append(anomalies, anomaly)
+	}
+
+	return anomalies, nil
+}
@@ -0,0 +1,132 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go-service/internal/models"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Изменения настроек анализатора, сделанные через API. Хранятся в хеше:
+// поля глобальных настроек по отдельности, чтобы частичные изменения с разных
+// экземпляров не затирали друг друга, и настройки устройств целиком в JSON.
+const (
+	analyzerConfigKey     = "analyzer:config"
+	analyzerDevicePrefix  = "device:"
+	analyzerDetectorField = "detector"
+	analyzerAverageField  = "average"
+	analyzerTrimField     = "trim_fraction"
+)
+
+// Действующие настройки, которые пишущие экземпляры публикуют для реплик чтения
+const activeAnalyzerConfigKey = "analyzer:config:active"
+
+// StoreAnalyzerConfigUpdate сохраняет изменение настроек анализатора, чтобы
+// его применили все экземпляры и оно пережило перезапуск. Без DeviceID
+// сохраняются непустые поля глобальных настроек; с DeviceID настройки
+// устройства заменяются целиком, а пустые настройки снимают переопределение.
+func (r *RedisClient) StoreAnalyzerConfigUpdate(update models.AnalyzerConfigUpdate) error {
+	var err error
+	switch {
+	case update.DeviceID == "":
+		fields := make(map[string]interface{})
+		if update.Detector != "" {
+			fields[analyzerDetectorField] = update.Detector
+		}
+		if update.Average != "" {
+			fields[analyzerAverageField] = update.Average
+		}
+		if update.TrimFraction != 0 {
+			fields[analyzerTrimField] = update.TrimFraction
+		}
+		if len(fields) == 0 {
+			return nil
+		}
+		err = r.client.HSet(r.ctx, analyzerConfigKey, fields).Err()
+	case update.AnalyzerSettings == (models.AnalyzerSettings{}):
+		err = r.client.HDel(r.ctx, analyzerConfigKey, analyzerDevicePrefix+update.DeviceID).Err()
+	default:
+		data, marshalErr := json.Marshal(update.AnalyzerSettings)
+		if marshalErr != nil {
+			return fmt.Errorf("failed to marshal analyzer settings: %w", marshalErr)
+		}
+		err = r.client.HSet(r.ctx, analyzerConfigKey, analyzerDevicePrefix+update.DeviceID, data).Err()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to store analyzer config: %w", err)
+	}
+
+	return nil
+}
+
+// GetAnalyzerConfigOverrides возвращает сохранённые изменения настроек.
+// В Global заполнены только изменённые поля. Читает основной экземпляр,
+// чтобы сразу видеть только что сохранённое изменение.
+func (r *RedisClient) GetAnalyzerConfigOverrides() (models.AnalyzerConfig, error) {
+	config := models.AnalyzerConfig{Devices: make(map[string]models.AnalyzerSettings)}
+
+	fields, err := r.client.HGetAll(r.ctx, analyzerConfigKey).Result()
+	if err != nil && err != redis.Nil {
+		return config, fmt.Errorf("failed to get analyzer config: %w", err)
+	}
+
+	for field, value := range fields {
+		switch {
+		case field == analyzerDetectorField:
+			config.Global.Detector = value
+		case field == analyzerAverageField:
+			config.Global.Average = value
+		case field == analyzerTrimField:
+			trimFraction, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return config, fmt.Errorf("invalid stored trim_fraction %q: %w", value, err)
+			}
+			config.Global.TrimFraction = trimFraction
+		case strings.HasPrefix(field, analyzerDevicePrefix):
+			var settings models.AnalyzerSettings
+			if err := json.Unmarshal([]byte(value), &settings); err != nil {
+				return config, fmt.Errorf("invalid stored settings for %s: %w", field, err)
+			}
+			config.Devices[strings.TrimPrefix(field, analyzerDevicePrefix)] = settings
+		}
+	}
+
+	return config, nil
+}
+
+// StoreActiveAnalyzerConfig публикует действующие настройки анализа пишущего
+// экземпляра для реплик чтения, как StoreAnalysis публикует статистику.
+func (r *RedisClient) StoreActiveAnalyzerConfig(config models.AnalyzerConfig) error {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("failed to marshal analyzer config: %w", err)
+	}
+
+	if err := r.client.Set(r.ctx, activeAnalyzerConfigKey, data, 0).Err(); err != nil {
+		return fmt.Errorf("failed to store active analyzer config: %w", err)
+	}
+
+	return nil
+}
+
+// GetActiveAnalyzerConfig возвращает настройки, опубликованные пишущим
+// экземпляром. found == false, если они ещё не опубликованы.
+func (r *RedisClient) GetActiveAnalyzerConfig() (config models.AnalyzerConfig, found bool, err error) {
+	data, err := r.reader().Get(r.ctx, activeAnalyzerConfigKey).Bytes()
+	if err == redis.Nil {
+		return config, false, nil
+	}
+	if err != nil {
+		return config, false, fmt.Errorf("failed to get active analyzer config: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, false, fmt.Errorf("failed to unmarshal active analyzer config: %w", err)
+	}
+
+	return config, true, nil
+}
@@ -0,0 +1,323 @@
+package cache
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"go-service/internal/models"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	schemaVersionKey   = "schema:version"
+	migrationLockKey   = "schema:migration:lock"
+	migrationStatusKey = "schema:migration:status"
+	// Схема без ключа версии - исходная
+	baseSchemaVersion  = 1
+	migrationBatchSize = 100
+	migrationLockTTL   = time.Hour
+)
+
+var ErrMigrationRunning = errors.New("migration is already running")
+
+// releaseLockScript снимает блокировку, только если она всё ещё принадлежит
+// запуску: после истечения TTL её мог взять другой экземпляр.
+var releaseLockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// extendLockScript продлевает блокировку, если она всё ещё принадлежит запуску.
+var extendLockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// Migration переводит данные Redis на схему Version. Миграции выполняются
+// на работающем сервисе, поэтому должны быть идемпотентными и не ломать
+// чтение и запись в процессе.
+type Migration struct {
+	Version int
+	Name    string
+	Run     func(r *RedisClient, progress func(done, total int)) error
+}
+
+// migrations упорядочены по версии
+var migrations = []Migration{
+	{Version: 2, Name: "backfill-device-series", Run: backfillDeviceSeries},
+}
+
+// Migrator выполняет ожидающие миграции. Блокировка и прогресс хранятся
+// в Redis, поэтому запуск виден со всех экземпляров сервиса, в том числе
+// запущенный отдельным процессом с флагом -migrate.
+type Migrator struct {
+	client *RedisClient
+}
+
+func NewMigrator(client *RedisClient) *Migrator {
+	return &Migrator{client: client}
+}
+
+func (m *Migrator) Status() (models.MigrationStatus, error) {
+	version, err := m.client.SchemaVersion()
+	if err != nil {
+		return models.MigrationStatus{}, err
+	}
+
+	status := models.MigrationStatus{State: models.MigrationIdle}
+	data, err := m.client.client.Get(m.client.ctx, migrationStatusKey).Bytes()
+	switch {
+	case err == redis.Nil:
+	case err != nil:
+		return status, fmt.Errorf("failed to get migration status: %w", err)
+	default:
+		if err := json.Unmarshal(data, &status); err != nil {
+			return status, fmt.Errorf("failed to unmarshal migration status: %w", err)
+		}
+	}
+
+	// Процесс, выполнявший миграцию, завершился, не записав итог,
+	// и его блокировка истекла
+	if status.State == models.MigrationRunning {
+		locked, err := m.client.client.Exists(m.client.ctx, migrationLockKey).Result()
+		if err != nil {
+			return status, fmt.Errorf("failed to check migration lock: %w", err)
+		}
+		if locked == 0 {
+			status.State = models.MigrationFailed
+			status.Error = "migration was interrupted"
+		}
+	}
+
+	status.SchemaVersion = version
+	status.LatestVersion = migrations[len(migrations)-1].Version
+	return status, nil
+}
+
+// Start запускает миграции в фоне.
+func (m *Migrator) Start() error {
+	run, err := m.begin()
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		if err := run.execute(); err != nil {
+			log.Printf("Migration failed: %v", err)
+		}
+	}()
+	return nil
+}
+
+// Run выполняет миграции синхронно.
+func (m *Migrator) Run() error {
+	run, err := m.begin()
+	if err != nil {
+		return err
+	}
+	return run.execute()
+}
+
+// migrationRun - запуск миграций, владеющий блокировкой со значением token.
+type migrationRun struct {
+	client *RedisClient
+	token  string
+	status models.MigrationStatus
+}
+
+func (m *Migrator) begin() (*migrationRun, error) {
+	token, err := newLockToken()
+	if err != nil {
+		return nil, err
+	}
+
+	// Блокировка в Redis не даёт запустить миграции на нескольких экземплярах сразу
+	ok, err := m.client.client.SetNX(m.client.ctx, migrationLockKey, token, migrationLockTTL).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	if !ok {
+		return nil, ErrMigrationRunning
+	}
+
+	run := &migrationRun{
+		client: m.client,
+		token:  token,
+		status: models.MigrationStatus{
+			State:     models.MigrationRunning,
+			StartedAt: time.Now(),
+		},
+	}
+	if err := run.saveStatus(); err != nil {
+		run.releaseLock()
+		return nil, err
+	}
+	return run, nil
+}
+
+func newLockToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate migration lock token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (run *migrationRun) execute() error {
+	// Итог записывается до снятия блокировки, чтобы запуск не выглядел прерванным
+	defer run.releaseLock()
+
+	err := run.migrate()
+
+	run.status.FinishedAt = time.Now()
+	if err != nil {
+		run.status.State = models.MigrationFailed
+		run.status.Error = err.Error()
+	} else {
+		run.status.State = models.MigrationDone
+	}
+	if saveErr := run.saveStatus(); saveErr != nil {
+		log.Printf("Failed to save migration status: %v", saveErr)
+	}
+
+	return err
+}
+
+func (run *migrationRun) migrate() error {
+	version, err := run.client.SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range migrations {
+		if migration.Version <= version {
+			continue
+		}
+
+		run.status.Migration = migration.Name
+		run.status.Done, run.status.Total = 0, 0
+		if err := run.saveStatus(); err != nil {
+			return err
+		}
+
+		log.Printf("Running migration %d (%s)", migration.Version, migration.Name)
+		err := migration.Run(run.client, func(done, total int) {
+			run.status.Done, run.status.Total = done, total
+			if err := run.saveStatus(); err != nil {
+				log.Printf("Failed to save migration status: %v", err)
+			}
+			run.extendLock()
+			log.Printf("Migration %s: %d/%d", migration.Name, done, total)
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d (%s): %w", migration.Version, migration.Name, err)
+		}
+
+		if err := run.client.client.Set(run.client.ctx, schemaVersionKey, migration.Version, 0).Err(); err != nil {
+			return fmt.Errorf("failed to update schema version: %w", err)
+		}
+		version = migration.Version
+	}
+
+	return nil
+}
+
+// saveStatus публикует прогресс запуска для всех экземпляров.
+func (run *migrationRun) saveStatus() error {
+	data, err := json.Marshal(run.status)
+	if err != nil {
+		return fmt.Errorf("failed to marshal migration status: %w", err)
+	}
+	if err := run.client.client.Set(run.client.ctx, migrationStatusKey, data, 0).Err(); err != nil {
+		return fmt.Errorf("failed to save migration status: %w", err)
+	}
+	return nil
+}
+
+// extendLock продлевает блокировку, пока миграция продвигается, чтобы долгий
+// перенос не потерял её по TTL.
+func (run *migrationRun) extendLock() {
+	ttl := strconv.FormatInt(migrationLockTTL.Milliseconds(), 10)
+	extended, err := extendLockScript.Run(run.client.ctx, run.client.client, []string{migrationLockKey}, run.token, ttl).Int()
+	if err != nil {
+		log.Printf("Failed to extend migration lock: %v", err)
+		return
+	}
+	if extended == 0 {
+		log.Printf("Migration lock is held by another instance")
+	}
+}
+
+func (run *migrationRun) releaseLock() {
+	if err := releaseLockScript.Run(run.client.ctx, run.client.client, []string{migrationLockKey}, run.token).Err(); err != nil {
+		log.Printf("Failed to release migration lock: %v", err)
+	}
+}
+
+// SchemaVersion возвращает текущую версию схемы данных в Redis.
+func (r *RedisClient) SchemaVersion() (int, error) {
+	v, err := r.client.Get(r.ctx, schemaVersionKey).Result()
+	if err == redis.Nil {
+		return baseSchemaVersion, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get schema version: %w", err)
+	}
+
+	version, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid schema version %q: %w", v, err)
+	}
+	return version, nil
+}
+
+// backfillDeviceSeries переносит метрики, сохранённые до появления рядов
+// устройств (отдельные ключи metric:* из списка metrics:recent), в сортированные
+// множества и агрегаты рядов. Уже проиндексированные метрики пропускаются.
+func backfillDeviceSeries(r *RedisClient, progress func(done, total int)) error {
+	keys, err := r.client.LRange(r.ctx, "metrics:recent", 0, -1).Result()
+	if err != nil {
+		return fmt.Errorf("failed to list metric keys: %w", err)
+	}
+
+	for start := 0; start < len(keys); start += migrationBatchSize {
+		end := min(start+migrationBatchSize, len(keys))
+
+		values, err := r.client.MGet(r.ctx, keys[start:end]...).Result()
+		if err != nil {
+			return fmt.Errorf("failed to load metrics: %w", err)
+		}
+
+		for _, value := range values {
+			data, ok := value.(string)
+			if !ok {
+				continue // ключ уже истёк
+			}
+
+			var metric models.Metric
+			if err := json.Unmarshal([]byte(data), &metric); err != nil {
+				continue
+			}
+
+			// Уже проиндексированную метрику indexMetric пропускает
+			if err := r.indexMetric(metric, []byte(data)); err != nil {
+				return err
+			}
+		}
+
+		progress(end, len(keys))
+	}
+
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	"go-service/internal/models"
@@ -11,13 +12,47 @@ import (
 	"github.com/go-redis/redis/v8"
 )
 
+const annotationsKey = "annotations"
+
+// RedisClient пишет в основной экземпляр Redis, а запросы чтения
+// (последние метрики, ряды, аннотации, аналитика, статистика использования)
+// по очереди распределяет между доступными репликами, если они заданы.
 type RedisClient struct {
-	client *redis.Client
-	ctx    context.Context
+	client   *redis.Client
+	replicas []*replica
+	next     uint32
+	ctx      context.Context
+	done     chan struct{}
 }
 
-func NewRedisClient(addr string) (*RedisClient, error) {
-	client := redis.NewClient(&redis.Options{
+func NewRedisClient(addr string, readAddrs ...string) (*RedisClient, error) {
+	ctx := context.Background()
+
+	client, err := connect(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &RedisClient{
+		client: client,
+		ctx:    ctx,
+		done:   make(chan struct{}),
+	}
+
+	// Недоступная реплика не мешает запуску: чтение идёт через остальные
+	// реплики или основной экземпляр, пока она не восстановится
+	for _, readAddr := range readAddrs {
+		r.replicas = append(r.replicas, newReplica(ctx, readAddr))
+	}
+	if len(r.replicas) > 0 {
+		go r.checkReplicas()
+	}
+
+	return r, nil
+}
+
+func newClient(addr string) *redis.Client {
+	return redis.NewClient(&redis.Options{
 		Addr:         addr,
 		Password:     "",
 		DB:           0,
@@ -25,18 +60,33 @@ func NewRedisClient(addr string) (*RedisClient, error) {
 		MinIdleConns: 10,
 		MaxRetries:   3,
 	})
+}
 
-	ctx := context.Background()
+func connect(ctx context.Context, addr string) (*redis.Client, error) {
+	client := newClient(addr)
 
 	// Проверка соединения
 	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
 		return nil, err
 	}
 
-	return &RedisClient{
-		client: client,
-		ctx:    ctx,
-	}, nil
+	return client, nil
+}
+
+// reader возвращает клиент для запросов чтения: следующую доступную реплику
+// по кругу или основной экземпляр, если реплик нет или все они недоступны.
+// Данные реплики могут немного отставать от записи, поэтому миграции
+// и проверки перед записью читают из основного экземпляра.
+func (r *RedisClient) reader() *redis.Client {
+	n := uint32(len(r.replicas))
+	start := atomic.AddUint32(&r.next, 1)
+	for i := uint32(0); i < n; i++ {
+		if replica := r.replicas[(start+i)%n]; replica.isHealthy() {
+			return replica.client
+		}
+	}
+	return r.client
 }
 
 func (r *RedisClient) StoreMetric(metric models.Metric) error {
@@ -63,20 +113,22 @@ func (r *RedisClient) StoreMetric(metric models.Metric) error {
 	// Ограничиваем список 1000 элементами
 	r.client.LTrim(r.ctx, listKey, 0, 999)
 
-	return nil
+	// Индексы устройства для запросов рядов
+	return r.indexMetric(metric, data)
 }
 
 func (r *RedisClient) GetRecentMetrics(count int64) ([]models.Metric, error) {
 	listKey := "metrics:recent"
+	reader := r.reader()
 
-	keys, err := r.client.LRange(r.ctx, listKey, 0, count-1).Result()
+	keys, err := reader.LRange(r.ctx, listKey, 0, count-1).Result()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get recent metric keys: %w", err)
 	}
 
 	var metrics []models.Metric
 	for _, key := range keys {
-		data, err := r.client.Get(r.ctx, key).Result()
+		data, err := reader.Get(r.ctx, key).Result()
 		if err != nil {
 			continue // Пропускаем невалидные ключи
 		}
@@ -92,6 +144,58 @@ func (r *RedisClient) GetRecentMetrics(count int64) ([]models.Metric, error) {
 	return metrics, nil
 }
 
+func (r *RedisClient) StoreAnnotation(annotation models.Annotation, retention time.Duration) error {
+	data, err := json.Marshal(annotation)
+	if err != nil {
+		return fmt.Errorf("failed to marshal annotation: %w", err)
+	}
+
+	score := float64(annotation.Timestamp.UnixMilli())
+	err = r.client.ZAdd(r.ctx, annotationsKey, &redis.Z{Score: score, Member: data}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to store annotation in Redis: %w", err)
+	}
+
+	// Удаляем аннотации старше срока хранения
+	cutoff := time.Now().Add(-retention).UnixMilli()
+	r.client.ZRemRangeByScore(r.ctx, annotationsKey, "-inf", fmt.Sprintf("(%d", cutoff))
+
+	return nil
+}
+
+// GetAnnotations возвращает аннотации за период [from, to] в порядке времени.
+// Если deviceID не пуст, в выборку попадают только аннотации этого устройства
+// и глобальные аннотации. Запрос прерывается при отмене ctx.
+func (r *RedisClient) GetAnnotations(ctx context.Context, from, to time.Time, deviceID string) ([]models.Annotation, error) {
+	items, err := r.reader().ZRangeByScore(ctx, annotationsKey, &redis.ZRangeBy{
+		Min: fmt.Sprintf("%d", from.UnixMilli()),
+		Max: fmt.Sprintf("%d", to.UnixMilli()),
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get annotations: %w", err)
+	}
+
+	annotations := make([]models.Annotation, 0, len(items))
+	for _, item := range items {
+		var annotation models.Annotation
+		if err := json.Unmarshal([]byte(item), &annotation); err != nil {
+			continue
+		}
+
+		if deviceID != "" && !annotation.AppliesTo(deviceID) {
+			continue
+		}
+
+		annotations = append(annotations, annotation)
+	}
+
+	return annotations, nil
+}
+
 func (r *RedisClient) Close() error {
+	close(r.done)
+	for _, replica := range r.replicas {
+		replica.client.Close()
+	}
 	return r.client.Close()
 }
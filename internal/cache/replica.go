@@ -0,0 +1,126 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// Период проверки реплик чтения
+	replicaCheckInterval = 5 * time.Second
+	// Проверка не ждёт таймаутов подключения и повторов клиента
+	replicaCheckTimeout = time.Second
+)
+
+// replica - реплика чтения. Реплика исключается из чтения при первой ошибке
+// соединения и возвращается, когда снова отвечает на PING.
+type replica struct {
+	addr    string
+	client  *redis.Client
+	healthy int32
+}
+
+func newReplica(ctx context.Context, addr string) *replica {
+	rep := &replica{addr: addr, client: newClient(addr)}
+	rep.client.AddHook(rep)
+
+	if err := rep.check(ctx); err != nil {
+		log.Printf("Redis replica %s is unavailable, reading from other instances: %v", addr, err)
+	}
+
+	return rep
+}
+
+func (rep *replica) isHealthy() bool {
+	return atomic.LoadInt32(&rep.healthy) == 1
+}
+
+func (rep *replica) setHealthy(healthy bool) {
+	var state int32
+	if healthy {
+		state = 1
+	}
+	if atomic.SwapInt32(&rep.healthy, state) == state {
+		return
+	}
+
+	if healthy {
+		log.Printf("Redis replica %s is available", rep.addr)
+	} else {
+		log.Printf("Redis replica %s is unavailable, reading from other instances", rep.addr)
+	}
+}
+
+func (rep *replica) check(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, replicaCheckTimeout)
+	defer cancel()
+
+	err := rep.client.Ping(ctx).Err()
+	rep.setHealthy(err == nil)
+	return err
+}
+
+// checkReplicas периодически проверяет реплики: отказавшие без чтений
+// исключаются, восстановившиеся возвращаются в чтение.
+func (r *RedisClient) checkReplicas() {
+	ticker := time.NewTicker(replicaCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+			for _, rep := range r.replicas {
+				rep.check(r.ctx)
+			}
+		}
+	}
+}
+
+// Хук клиента реплики: ошибка соединения сразу исключает реплику из чтения,
+// не дожидаясь очередной проверки.
+
+func (rep *replica) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (rep *replica) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	if isConnError(cmd.Err()) {
+		rep.setHealthy(false)
+	}
+	return nil
+}
+
+func (rep *replica) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (rep *replica) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	for _, cmd := range cmds {
+		if isConnError(cmd.Err()) {
+			rep.setHealthy(false)
+			break
+		}
+	}
+	return nil
+}
+
+// isConnError отличает недоступность экземпляра от ответа Redis с ошибкой
+// и отмены запроса вызывающим.
+func isConnError(err error) bool {
+	if err == nil || err == redis.Nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var redisErr redis.Error
+	return !errors.As(err, &redisErr)
+}
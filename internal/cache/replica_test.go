@@ -0,0 +1,74 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func TestReaderSkipsUnhealthyReplicas(t *testing.T) {
+	primary := newClient("primary.invalid:6379")
+	down := &replica{addr: "down.invalid:6379", client: newClient("down.invalid:6379")}
+	up := &replica{addr: "up.invalid:6379", client: newClient("up.invalid:6379"), healthy: 1}
+	r := &RedisClient{client: primary, replicas: []*replica{down, up}}
+
+	for i := 0; i < 4; i++ {
+		if got := r.reader(); got != up.client {
+			t.Fatalf("reader() returned %v, want healthy replica", got)
+		}
+	}
+
+	// Все реплики недоступны - чтение идёт в основной экземпляр
+	up.setHealthy(false)
+	if got := r.reader(); got != primary {
+		t.Errorf("reader() returned %v, want primary", got)
+	}
+}
+
+func TestNewReplicaUnreachable(t *testing.T) {
+	// Закрытый порт: реплика создаётся, но в чтение не попадает
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("listen: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	rep := newReplica(context.Background(), addr)
+	defer rep.client.Close()
+
+	if rep.isHealthy() {
+		t.Error("unreachable replica is marked healthy")
+	}
+}
+
+// replyError - ошибка, которую вернул сам Redis
+type replyError string
+
+func (e replyError) Error() string { return string(e) }
+
+func (replyError) RedisError() {}
+
+func TestIsConnError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"missing key", redis.Nil, false},
+		{"cancelled", fmt.Errorf("get: %w", context.Canceled), false},
+		{"redis reply", replyError("WRONGTYPE Operation against a key holding the wrong kind of value"), false},
+		{"connection refused", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, true},
+	}
+
+	for _, tt := range tests {
+		if got := isConnError(tt.err); got != tt.want {
+			t.Errorf("%s: isConnError = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"go-service/internal/models"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Resolution - разрешение хранения ряда. Step == 0 означает сырые метрики.
+type Resolution struct {
+	Name      string
+	Step      time.Duration
+	Retention time.Duration
+}
+
+// Resolutions упорядочены от самого детального к самому грубому.
+var Resolutions = []Resolution{
+	{Name: "raw", Step: 0, Retention: time.Hour},
+	{Name: "1m", Step: time.Minute, Retention: 24 * time.Hour},
+	{Name: "1h", Step: time.Hour, Retention: 30 * 24 * time.Hour},
+}
+
+func rawIndexKey(deviceID string) string {
+	return fmt.Sprintf("metrics:device:%s", deviceID)
+}
+
+func rollupIndexKey(res Resolution, deviceID string) string {
+	return fmt.Sprintf("rollup:%s:%s", res.Name, deviceID)
+}
+
+func rollupBucketKey(res Resolution, deviceID string, bucket int64) string {
+	return fmt.Sprintf("rollup:%s:%s:%d", res.Name, deviceID, bucket)
+}
+
+// indexScript добавляет метрику в сырой индекс устройства и, только если её
+// там ещё не было, учитывает в агрегатах. Так повторная индексация той же
+// метрики (приём и миграция одновременно) не удваивает агрегаты. Метрики
+// старше срока хранения сырых данных пропускаются: без сырого индекса
+// повтор уже не отличить от первой записи.
+//
+// KEYS: сырой индекс, затем для каждого агрегата бакет и индекс бакетов.
+// ARGV: метрика, её время (мс), граница и срок хранения (с) сырых данных,
+// rps, cpu_usage, memory_usage, latency_ms, затем для каждого агрегата
+// время бакета (мс), бакет (unix), граница и срок хранения (с).
+var indexScript = redis.NewScript(`
+local ts = tonumber(ARGV[2])
+if ts < tonumber(ARGV[3]) then
+	return 0
+end
+if redis.call('ZADD', KEYS[1], 'NX', ts, ARGV[1]) == 0 then
+	return 0
+end
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', '(' .. ARGV[3])
+redis.call('EXPIRE', KEYS[1], ARGV[4])
+
+for i = 2, #KEYS, 2 do
+	local bucketKey, indexKey = KEYS[i], KEYS[i + 1]
+	local arg = 9 + (i - 2) * 2
+	redis.call('HINCRBY', bucketKey, 'count', 1)
+	redis.call('HINCRBYFLOAT', bucketKey, 'rps', ARGV[5])
+	redis.call('HINCRBYFLOAT', bucketKey, 'cpu_usage', ARGV[6])
+	redis.call('HINCRBYFLOAT', bucketKey, 'memory_usage', ARGV[7])
+	redis.call('HINCRBYFLOAT', bucketKey, 'latency_ms', ARGV[8])
+	redis.call('EXPIRE', bucketKey, ARGV[arg + 3])
+
+	redis.call('ZADD', indexKey, ARGV[arg], ARGV[arg + 1])
+	redis.call('ZREMRANGEBYSCORE', indexKey, '-inf', '(' .. ARGV[arg + 2])
+	redis.call('EXPIRE', indexKey, ARGV[arg + 3])
+end
+return 1
+`)
+
+// indexMetric добавляет метрику в сырой индекс устройства и в агрегаты всех
+// разрешений. Повторный вызов для уже проиндексированной метрики ничего не меняет.
+func (r *RedisClient) indexMetric(metric models.Metric, data []byte) error {
+	now := time.Now()
+	keys := []string{rawIndexKey(metric.DeviceID)}
+	args := []interface{}{data, metric.Timestamp.UnixMilli(), 0, 0,
+		metric.RPS, metric.CPUUsage, metric.MemoryUsage, metric.Latency}
+
+	for _, res := range Resolutions {
+		cutoff := now.Add(-res.Retention).UnixMilli()
+		retention := int64(res.Retention / time.Second)
+
+		if res.Step == 0 {
+			args[2], args[3] = cutoff, retention
+			continue
+		}
+
+		bucket := metric.Timestamp.Truncate(res.Step)
+		keys = append(keys, rollupBucketKey(res, metric.DeviceID, bucket.Unix()), rollupIndexKey(res, metric.DeviceID))
+		args = append(args, bucket.UnixMilli(), bucket.Unix(), cutoff, retention)
+	}
+
+	if err := indexScript.Run(r.ctx, r.client, keys, args...).Err(); err != nil {
+		return fmt.Errorf("failed to index metric: %w", err)
+	}
+
+	return nil
+}
+
+// ChooseResolution выбирает самое грубое разрешение, которое всё ещё даёт
+// не меньше maxPoints точек за период, среди разрешений, чей срок хранения
+// на момент now покрывает начало периода. Если начало периода старше любого
+// срока хранения, используется самое грубое разрешение. now должен быть тем же
+// моментом, от которого отсчитан период по умолчанию, иначе период ровно
+// в срок хранения сырых данных на них уже не попадает.
+func ChooseResolution(from, to, now time.Time, maxPoints int) Resolution {
+	targetStep := to.Sub(from) / time.Duration(maxPoints)
+
+	var chosen *Resolution
+	for i := range Resolutions {
+		res := &Resolutions[i]
+		if from.Before(now.Add(-res.Retention)) {
+			continue
+		}
+		if chosen == nil || res.Step <= targetStep {
+			chosen = res
+		}
+	}
+
+	if chosen == nil {
+		return Resolutions[len(Resolutions)-1]
+	}
+	return *chosen
+}
+
+// GetSeries возвращает точки ряда устройства за период [from, to] в заданном
+// разрешении. Запрос прерывается при отмене ctx.
+func (r *RedisClient) GetSeries(ctx context.Context, deviceID string, from, to time.Time, res Resolution) ([]models.SeriesPoint, error) {
+	reader := r.reader()
+	rangeBy := &redis.ZRangeBy{
+		Min: strconv.FormatInt(from.UnixMilli(), 10),
+		Max: strconv.FormatInt(to.UnixMilli(), 10),
+	}
+
+	if res.Step == 0 {
+		items, err := reader.ZRangeByScore(ctx, rawIndexKey(deviceID), rangeBy).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get raw series: %w", err)
+		}
+
+		points := make([]models.SeriesPoint, 0, len(items))
+		for _, item := range items {
+			var metric models.Metric
+			if err := json.Unmarshal([]byte(item), &metric); err != nil {
+				continue
+			}
+			points = append(points, models.SeriesPoint{
+				Timestamp:   metric.Timestamp,
+				Count:       1,
+				RPS:         metric.RPS,
+				CPUUsage:    metric.CPUUsage,
+				MemoryUsage: metric.MemoryUsage,
+				Latency:     metric.Latency,
+			})
+		}
+		return points, nil
+	}
+
+	// Бакет, начавшийся до from, тоже попадает в период частично
+	rangeBy.Min = strconv.FormatInt(from.Truncate(res.Step).UnixMilli(), 10)
+	buckets, err := reader.ZRangeByScore(ctx, rollupIndexKey(res, deviceID), rangeBy).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rollup index: %w", err)
+	}
+
+	pipe := reader.Pipeline()
+	cmds := make([]*redis.StringStringMapCmd, len(buckets))
+	for i, bucket := range buckets {
+		ts, _ := strconv.ParseInt(bucket, 10, 64)
+		cmds[i] = pipe.HGetAll(ctx, rollupBucketKey(res, deviceID, ts))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to get rollup buckets: %w", err)
+	}
+
+	points := make([]models.SeriesPoint, 0, len(buckets))
+	for i, bucket := range buckets {
+		fields := cmds[i].Val()
+		count, _ := strconv.ParseInt(fields["count"], 10, 64)
+		if count == 0 {
+			continue // бакет истёк раньше индекса
+		}
+
+		ts, _ := strconv.ParseInt(bucket, 10, 64)
+		points = append(points, models.SeriesPoint{
+			Timestamp:   time.Unix(ts, 0).UTC(),
+			Count:       count,
+			RPS:         average(fields["rps"], count),
+			CPUUsage:    average(fields["cpu_usage"], count),
+			MemoryUsage: average(fields["memory_usage"], count),
+			Latency:     average(fields["latency_ms"], count),
+		})
+	}
+
+	return points, nil
+}
+
+func average(sum string, count int64) float64 {
+	v, _ := strconv.ParseFloat(sum, 64)
+	return v / float64(count)
+}
+
+// Downsample объединяет точки в интервалы длиной step, начиная с from,
+// усредняя значения с весом по числу исходных метрик. Точки должны быть
+// упорядочены по времени.
+func Downsample(points []models.SeriesPoint, from time.Time, step time.Duration) []models.SeriesPoint {
+	if step <= 0 || len(points) == 0 {
+		return points
+	}
+
+	result := make([]models.SeriesPoint, 0)
+	var current *models.SeriesPoint
+	for _, p := range points {
+		bucket := from.Add(p.Timestamp.Sub(from) / step * step)
+		if current == nil || !current.Timestamp.Equal(bucket) {
+			if current != nil {
+				result = append(result, finalize(*current))
+			}
+			current = &models.SeriesPoint{Timestamp: bucket}
+		}
+
+		weight := float64(p.Count)
+		current.Count += p.Count
+		current.RPS += p.RPS * weight
+		current.CPUUsage += p.CPUUsage * weight
+		current.MemoryUsage += p.MemoryUsage * weight
+		current.Latency += p.Latency * weight
+	}
+	result = append(result, finalize(*current))
+
+	return result
+}
+
+func finalize(p models.SeriesPoint) models.SeriesPoint {
+	if p.Count == 0 {
+		return p
+	}
+	n := float64(p.Count)
+	p.RPS /= n
+	p.CPUUsage /= n
+	p.MemoryUsage /= n
+	p.Latency /= n
+	return p
+}
@@ -0,0 +1,98 @@
+package cache
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"go-service/internal/models"
+)
+
+func TestChooseResolution(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		from, to  time.Time
+		maxPoints int
+		want      string
+	}{
+		{"default hour uses raw", now.Add(-time.Hour), now, 500, "raw"},
+		{"short range uses raw", now.Add(-10 * time.Minute), now, 500, "raw"},
+		{"hour with few points uses 1m", now.Add(-time.Hour), now, 30, "1m"},
+		{"day uses 1m", now.Add(-24 * time.Hour), now, 500, "1m"},
+		{"older than raw retention uses 1m", now.Add(-2 * time.Hour), now.Add(-90 * time.Minute), 500, "1m"},
+		{"week uses 1h", now.Add(-7 * 24 * time.Hour), now, 500, "1h"},
+		{"day with few points uses 1h", now.Add(-24 * time.Hour), now, 10, "1h"},
+		{"beyond all retention uses 1h", now.Add(-90 * 24 * time.Hour), now, 500, "1h"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ChooseResolution(tt.from, tt.to, now, tt.maxPoints); got.Name != tt.want {
+				t.Errorf("ChooseResolution = %s, want %s", got.Name, tt.want)
+			}
+		})
+	}
+}
+
+func TestDownsample(t *testing.T) {
+	from := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	points := []models.SeriesPoint{
+		{Timestamp: from, Count: 1, RPS: 10, CPUUsage: 1, MemoryUsage: 100, Latency: 5},
+		{Timestamp: from.Add(30 * time.Second), Count: 3, RPS: 20, CPUUsage: 2, MemoryUsage: 200, Latency: 10},
+		{Timestamp: from.Add(2 * time.Minute), Count: 2, RPS: 50, CPUUsage: 5, MemoryUsage: 500, Latency: 25},
+	}
+
+	got := Downsample(points, from, time.Minute)
+
+	want := []models.SeriesPoint{
+		// Среднее взвешено по числу метрик: (10*1 + 20*3) / 4
+		{Timestamp: from, Count: 4, RPS: 17.5, CPUUsage: 1.75, MemoryUsage: 175, Latency: 8.75},
+		// Пустые интервалы пропускаются
+		{Timestamp: from.Add(2 * time.Minute), Count: 2, RPS: 50, CPUUsage: 5, MemoryUsage: 500, Latency: 25},
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("Downsample returned %d points, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if !got[i].Timestamp.Equal(want[i].Timestamp) || got[i].Count != want[i].Count ||
+			!approxEqual(got[i].RPS, want[i].RPS) || !approxEqual(got[i].CPUUsage, want[i].CPUUsage) ||
+			!approxEqual(got[i].MemoryUsage, want[i].MemoryUsage) || !approxEqual(got[i].Latency, want[i].Latency) {
+			t.Errorf("point %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestDownsampleBucketsFromStart(t *testing.T) {
+	// Интервалы отсчитываются от from, а не от начала минуты
+	from := time.Date(2024, 5, 1, 12, 0, 20, 0, time.UTC)
+	points := []models.SeriesPoint{
+		{Timestamp: from.Add(50 * time.Second), Count: 1, RPS: 1},
+		{Timestamp: from.Add(70 * time.Second), Count: 1, RPS: 3},
+	}
+
+	got := Downsample(points, from, time.Minute)
+	if len(got) != 2 {
+		t.Fatalf("Downsample returned %d points, want 2", len(got))
+	}
+	if !got[0].Timestamp.Equal(from) || !got[1].Timestamp.Equal(from.Add(time.Minute)) {
+		t.Errorf("bucket timestamps = %v, %v", got[0].Timestamp, got[1].Timestamp)
+	}
+}
+
+func TestDownsampleNoop(t *testing.T) {
+	points := []models.SeriesPoint{{Timestamp: time.Now(), Count: 1, RPS: 1}}
+
+	if got := Downsample(points, time.Now(), 0); len(got) != 1 {
+		t.Errorf("Downsample with zero step returned %d points, want 1", len(got))
+	}
+	if got := Downsample(nil, time.Now(), time.Minute); len(got) != 0 {
+		t.Errorf("Downsample of no points returned %d points", len(got))
+	}
+}
+
+func approxEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
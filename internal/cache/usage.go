@@ -0,0 +1,95 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"go-service/internal/models"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Срок хранения дневных счётчиков использования
+const usageRetention = 90 * 24 * time.Hour
+
+func usageKey(day, tenant string) string {
+	return fmt.Sprintf("usage:%s:%s", day, tenant)
+}
+
+func usageTenantsKey(day string) string {
+	return fmt.Sprintf("usage:%s:tenants", day)
+}
+
+// AddUsage прибавляет счётчики к дневной статистике тенанта.
+func (r *RedisClient) AddUsage(day, tenant string, counters models.UsageCounters) error {
+	key := usageKey(day, tenant)
+	tenantsKey := usageTenantsKey(day)
+
+	_, err := r.client.TxPipelined(r.ctx, func(pipe redis.Pipeliner) error {
+		pipe.HIncrBy(r.ctx, key, "ingest_requests", counters.IngestRequests)
+		pipe.HIncrBy(r.ctx, key, "ingest_bytes", counters.IngestBytes)
+		pipe.HIncrBy(r.ctx, key, "query_requests", counters.QueryRequests)
+		pipe.HIncrBy(r.ctx, key, "query_bytes", counters.QueryBytes)
+		pipe.Expire(r.ctx, key, usageRetention)
+		pipe.SAdd(r.ctx, tenantsKey, tenant)
+		pipe.Expire(r.ctx, tenantsKey, usageRetention)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store usage: %w", err)
+	}
+
+	return nil
+}
+
+// GetUsage возвращает дневную статистику за дни с from по to включительно.
+// Пустой tenant означает всех тенантов. Запрос прерывается при отмене ctx.
+func (r *RedisClient) GetUsage(ctx context.Context, from, to time.Time, tenant string) ([]models.UsageRecord, error) {
+	records := make([]models.UsageRecord, 0)
+	reader := r.reader()
+
+	for day := from.UTC().Truncate(24 * time.Hour); !day.After(to); day = day.Add(24 * time.Hour) {
+		date := day.Format(models.UsageDayFormat)
+
+		tenants := []string{tenant}
+		if tenant == "" {
+			var err error
+			tenants, err = reader.SMembers(ctx, usageTenantsKey(date)).Result()
+			if err != nil {
+				return nil, fmt.Errorf("failed to get usage tenants: %w", err)
+			}
+			sort.Strings(tenants)
+		}
+
+		for _, t := range tenants {
+			fields, err := reader.HGetAll(ctx, usageKey(date, t)).Result()
+			if err != nil {
+				return nil, fmt.Errorf("failed to get usage: %w", err)
+			}
+			if len(fields) == 0 {
+				continue
+			}
+
+			records = append(records, models.UsageRecord{
+				Date:   date,
+				Tenant: t,
+				UsageCounters: models.UsageCounters{
+					IngestRequests: parseInt(fields["ingest_requests"]),
+					IngestBytes:    parseInt(fields["ingest_bytes"]),
+					QueryRequests:  parseInt(fields["query_requests"]),
+					QueryBytes:     parseInt(fields["query_bytes"]),
+				},
+			})
+		}
+	}
+
+	return records, nil
+}
+
+func parseInt(s string) int64 {
+	v, _ := strconv.ParseInt(s, 10, 64)
+	return v
+}
@@ -0,0 +1,268 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-service/internal/models"
+
+	"gopkg.in/yaml.v3"
+)
+
+const DefaultPath = "config/config.yaml"
+
+// Допустимые имена меток Alertmanager
+var labelNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+type Config struct {
+	Server      ServerConfig      `yaml:"server"`
+	Redis       RedisConfig       `yaml:"redis"`
+	Analyzer    AnalyzerConfig    `yaml:"analyzer"`
+	Annotations AnnotationsConfig `yaml:"annotations"`
+	Usage       UsageConfig       `yaml:"usage"`
+
+	// Реестр устройств: ID -> описание
+	Devices       map[string]models.Device `yaml:"devices"`
+	Notifications NotificationsConfig      `yaml:"notifications"`
+	Alertmanager  AlertmanagerConfig       `yaml:"alertmanager"`
+}
+
+type ServerConfig struct {
+	Port              string                   `yaml:"port"`
+	ReadTimeout       time.Duration            `yaml:"read_timeout"`
+	ReadHeaderTimeout time.Duration            `yaml:"read_header_timeout"`
+	WriteTimeout      time.Duration            `yaml:"write_timeout"`
+	IdleTimeout       time.Duration            `yaml:"idle_timeout"`
+	ShutdownTimeout   time.Duration            `yaml:"shutdown_timeout"`
+	RouteTimeouts     map[string]time.Duration `yaml:"route_timeouts"`
+	// Экземпляр только обслуживает чтение из общего Redis и отклоняет запись
+	ReadOnly bool `yaml:"read_only"`
+}
+
+type RedisConfig struct {
+	Addr string `yaml:"addr"`
+	// Реплики для запросов чтения; пусто - всё читается из addr
+	ReadAddrs []string `yaml:"read_addrs"`
+}
+
+type AnalyzerConfig struct {
+	WindowSize      int     `yaml:"window_size"`
+	ZScoreThreshold float64 `yaml:"z_score_threshold"`
+	// Детектор по умолчанию; меняется на лету через /config/analyzer
+	Detector string `yaml:"detector"`
+	// Способ расчёта скользящего среднего: mean, trimmed или winsorized
+	Average      string  `yaml:"average"`
+	TrimFraction float64 `yaml:"trim_fraction"`
+	// Окно устройства удаляется, если оно не присылало метрики дольше DeviceIdleTTL
+	DeviceIdleTTL time.Duration `yaml:"device_idle_ttl"`
+	// Сколько устройств анализируется одновременно; при превышении
+	// вытесняется устройство, дольше всех не присылавшее метрики
+	MaxDevices int `yaml:"max_devices"`
+	// Как часто перечитывать изменения настроек, сохранённые в Redis через /config/analyzer
+	ConfigPollInterval time.Duration `yaml:"config_poll_interval"`
+}
+
+type AnnotationsConfig struct {
+	// Насколько далеко до аномалии искать связанные аннотации
+	Lookback  time.Duration `yaml:"lookback"`
+	Retention time.Duration `yaml:"retention"`
+}
+
+type UsageConfig struct {
+	// API-ключ (заголовок X-API-Key) -> тенант
+	APIKeys       map[string]string `yaml:"api_keys"`
+	FlushInterval time.Duration     `yaml:"flush_interval"`
+}
+
+type AlertmanagerConfig struct {
+	// Адрес Alertmanager для отправки алертов; пусто - отправка отключена
+	URL          string        `yaml:"url"`
+	PushInterval time.Duration `yaml:"push_interval"`
+	// Сколько аномалия считается активной после последнего срабатывания
+	ActiveWindow time.Duration `yaml:"active_window"`
+}
+
+type NotificationsConfig struct {
+	Channels []ChannelConfig `yaml:"channels"`
+	Rules    []RuleConfig    `yaml:"rules"`
+}
+
+// ChannelConfig - канал доставки уведомлений: slack, email или webhook.
+type ChannelConfig struct {
+	Name string `yaml:"name"`
+	Type string `yaml:"type"`
+	// slack, webhook
+	URL string `yaml:"url"`
+	// email
+	SMTPAddr string   `yaml:"smtp_addr"`
+	From     string   `yaml:"from"`
+	To       []string `yaml:"to"`
+}
+
+// RuleConfig - правило маршрутизации аномалий в каналы. Пустые Severity
+// и Devices означают любую критичность и любое устройство.
+type RuleConfig struct {
+	Name     string   `yaml:"name"`
+	Severity string   `yaml:"severity"`
+	Devices  []string `yaml:"devices"`
+	Channels []string `yaml:"channels"`
+	// Шаблоны сообщений по типу канала (slack, email, webhook)
+	Templates map[string]TemplateConfig `yaml:"templates"`
+}
+
+// TemplateConfig - шаблоны text/template для сообщения. Subject используется только для email.
+type TemplateConfig struct {
+	Subject string `yaml:"subject"`
+	Body    string `yaml:"body"`
+}
+
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			Port:              "8080",
+			ReadTimeout:       10 * time.Second,
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      10 * time.Second,
+			IdleTimeout:       30 * time.Second,
+			ShutdownTimeout:   30 * time.Second,
+			RouteTimeouts:     map[string]time.Duration{},
+		},
+		Redis: RedisConfig{
+			Addr: "localhost:6379",
+		},
+		Analyzer: AnalyzerConfig{
+			WindowSize:         50,
+			ZScoreThreshold:    2.0,
+			Detector:           "zscore",
+			Average:            "mean",
+			TrimFraction:       0.1,
+			DeviceIdleTTL:      time.Hour,
+			MaxDevices:         10000,
+			ConfigPollInterval: 10 * time.Second,
+		},
+		Annotations: AnnotationsConfig{
+			Lookback:  10 * time.Minute,
+			Retention: 7 * 24 * time.Hour,
+		},
+		Usage: UsageConfig{
+			FlushInterval: 10 * time.Second,
+		},
+		Alertmanager: AlertmanagerConfig{
+			PushInterval: 30 * time.Second,
+			ActiveWindow: 5 * time.Minute,
+		},
+	}
+}
+
+// Load читает конфигурацию из YAML-файла поверх значений по умолчанию.
+// Отсутствующий файл не считается ошибкой. Переменные окружения REDIS_ADDR,
+// REDIS_READ_ADDRS (через запятую), PORT и READ_ONLY имеют приоритет над файлом.
+func Load(path string) (Config, error) {
+	cfg := Default()
+
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := yaml.Unmarshal(data, &cfg); err != nil {
+			return cfg, fmt.Errorf("failed to parse config %s: %w", path, err)
+		}
+	case errors.Is(err, os.ErrNotExist):
+	default:
+		return cfg, fmt.Errorf("failed to read config %s: %w", path, err)
+	}
+
+	if addr := os.Getenv("REDIS_ADDR"); addr != "" {
+		cfg.Redis.Addr = addr
+	}
+	if addrs := os.Getenv("REDIS_READ_ADDRS"); addrs != "" {
+		cfg.Redis.ReadAddrs = nil
+		for _, addr := range strings.Split(addrs, ",") {
+			if addr = strings.TrimSpace(addr); addr != "" {
+				cfg.Redis.ReadAddrs = append(cfg.Redis.ReadAddrs, addr)
+			}
+		}
+	}
+	if port := os.Getenv("PORT"); port != "" {
+		cfg.Server.Port = port
+	}
+	if readOnly := os.Getenv("READ_ONLY"); readOnly != "" {
+		v, err := strconv.ParseBool(readOnly)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid READ_ONLY: %w", err)
+		}
+		cfg.Server.ReadOnly = v
+	}
+
+	for id, device := range cfg.Devices {
+		device.ID = id
+		cfg.Devices[id] = device
+	}
+
+	if err := cfg.validate(); err != nil {
+		return cfg, err
+	}
+
+	return cfg, nil
+}
+
+func (c Config) validate() error {
+	durations := map[string]time.Duration{
+		"server.read_timeout":        c.Server.ReadTimeout,
+		"server.read_header_timeout": c.Server.ReadHeaderTimeout,
+		"server.write_timeout":       c.Server.WriteTimeout,
+		"server.idle_timeout":        c.Server.IdleTimeout,
+		"server.shutdown_timeout":    c.Server.ShutdownTimeout,
+		"annotations.lookback":       c.Annotations.Lookback,
+	}
+	for name, d := range durations {
+		if d < 0 {
+			return fmt.Errorf("%s must not be negative", name)
+		}
+	}
+
+	if c.Analyzer.WindowSize <= 0 {
+		return errors.New("analyzer.window_size must be positive")
+	}
+	if c.Analyzer.ZScoreThreshold <= 0 {
+		return errors.New("analyzer.z_score_threshold must be positive")
+	}
+	if c.Analyzer.DeviceIdleTTL <= 0 || c.Analyzer.MaxDevices <= 0 {
+		return errors.New("analyzer.device_idle_ttl and analyzer.max_devices must be positive")
+	}
+	if c.Analyzer.ConfigPollInterval <= 0 {
+		return errors.New("analyzer.config_poll_interval must be positive")
+	}
+
+	if c.Annotations.Retention <= 0 {
+		return errors.New("annotations.retention must be positive")
+	}
+	if c.Usage.FlushInterval <= 0 {
+		return errors.New("usage.flush_interval must be positive")
+	}
+	if c.Alertmanager.PushInterval <= 0 || c.Alertmanager.ActiveWindow <= 0 {
+		return errors.New("alertmanager.push_interval and alertmanager.active_window must be positive")
+	}
+
+	for route, d := range c.Server.RouteTimeouts {
+		if d <= 0 {
+			return fmt.Errorf("server.route_timeouts[%s] must be positive", route)
+		}
+	}
+
+	// Метки устройств попадают в алерты, и Alertmanager из-за одного
+	// неверного имени отклонил бы всю отправку
+	for id, device := range c.Devices {
+		for name := range device.Labels {
+			if !labelNamePattern.MatchString(name) || strings.HasPrefix(name, "__") {
+				return fmt.Errorf("devices.%s.labels: invalid label name %q", id, name)
+			}
+		}
+	}
+
+	return nil
+}
@@ -2,6 +2,12 @@ package models
 
 import "time"
 
+// Уровни критичности аномалий
+const (
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
 type Metric struct {
 	Timestamp   time.Time `json:"timestamp"`
 	DeviceID    string    `json:"device_id"`
@@ -9,6 +15,8 @@ type Metric struct {
 	MemoryUsage float64   `json:"memory_usage"`
 	RPS         float64   `json:"rps"`
 	Latency     float64   `json:"latency_ms"`
+	// Момент приёма метрики сервисом
+	ReceivedAt time.Time `json:"received_at"`
 }
 
 type AnalysisResult struct {
@@ -16,7 +24,116 @@ type AnalysisResult struct {
 	Metric         Metric    `json:"metric"`
 	RollingAverage float64   `json:"rolling_average"`
 	ZScore         float64   `json:"z_score"`
+	Detector       string    `json:"detector"`
+	Score          float64   `json:"score"`
 	IsAnomaly      bool      `json:"is_anomaly"`
+	Severity       string    `json:"severity,omitempty"`
+
+	// Серия аномалий устройства, к которой относится аномалия
+	Streak *AnomalyStreak `json:"streak,omitempty"`
+
+	// Время от приёма метрики до завершения анализа, включая ожидание
+	// в очереди и запись метрики в кэш. Запись самого результата анализа
+	// в кэш происходит позже и в это время не входит
+	PipelineLatencyMs float64 `json:"pipeline_latency_ms"`
+
+	// Внешние события, предшествовавшие аномалии (заполняется при выдаче)
+	Annotations []Annotation `json:"annotations,omitempty"`
+}
+
+// AnomalyStreak - серия аномалий устройства с промежутками не больше
+// alertmanager.active_window
+type AnomalyStreak struct {
+	StartedAt time.Time `json:"started_at"`
+	LastAt    time.Time `json:"last_at"`
+	// Критичность первой аномалии серии
+	Severity    string `json:"severity"`
+	MaxSeverity string `json:"max_severity"`
+	Count       int    `json:"count"`
+}
+
+// Device - описание устройства из реестра конфигурации
+type Device struct {
+	ID       string            `json:"id" yaml:"-"`
+	Name     string            `json:"name,omitempty" yaml:"name"`
+	Owner    string            `json:"owner,omitempty" yaml:"owner"`
+	Location string            `json:"location,omitempty" yaml:"location"`
+	Labels   map[string]string `json:"labels,omitempty" yaml:"labels"`
+}
+
+// SeriesPoint - точка ряда метрик устройства. Значения усреднены
+// по Count исходным метрикам.
+type SeriesPoint struct {
+	Timestamp   time.Time `json:"timestamp"`
+	Count       int64     `json:"count"`
+	RPS         float64   `json:"rps"`
+	CPUUsage    float64   `json:"cpu_usage"`
+	MemoryUsage float64   `json:"memory_usage"`
+	Latency     float64   `json:"latency_ms"`
+}
+
+type SeriesResponse struct {
+	DeviceID    string        `json:"device_id"`
+	From        time.Time     `json:"from"`
+	To          time.Time     `json:"to"`
+	Resolution  string        `json:"resolution"`
+	StepSeconds float64       `json:"step_seconds"`
+	Points      []SeriesPoint `json:"points"`
+	Annotations []Annotation  `json:"annotations,omitempty"`
+}
+
+// UsageCounters - объём использования сервиса тенантом
+type UsageCounters struct {
+	IngestRequests int64 `json:"ingest_requests"`
+	IngestBytes    int64 `json:"ingest_bytes"`
+	QueryRequests  int64 `json:"query_requests"`
+	QueryBytes     int64 `json:"query_bytes"`
+}
+
+// Формат даты дневной статистики использования
+const UsageDayFormat = "2006-01-02"
+
+// UsageRecord - дневные счётчики использования тенанта (дата в UTC)
+type UsageRecord struct {
+	Date   string `json:"date"`
+	Tenant string `json:"tenant"`
+	UsageCounters
+}
+
+// Состояния миграции схемы Redis
+const (
+	MigrationIdle    = "idle"
+	MigrationRunning = "running"
+	MigrationDone    = "done"
+	MigrationFailed  = "failed"
+)
+
+type MigrationStatus struct {
+	State         string    `json:"state"`
+	SchemaVersion int       `json:"schema_version"`
+	LatestVersion int       `json:"latest_version"`
+	Migration     string    `json:"migration,omitempty"`
+	Done          int       `json:"done"`
+	Total         int       `json:"total"`
+	StartedAt     time.Time `json:"started_at,omitempty"`
+	FinishedAt    time.Time `json:"finished_at,omitempty"`
+	Error         string    `json:"error,omitempty"`
+}
+
+// Annotation - внешнее событие (деплой, изменение конфигурации, инцидент),
+// которое помогает объяснить аномалию. Пустой DeviceID означает, что событие
+// относится ко всем устройствам.
+type Annotation struct {
+	Timestamp   time.Time `json:"timestamp"`
+	Type        string    `json:"type"`
+	Title       string    `json:"title"`
+	Description string    `json:"description,omitempty"`
+	DeviceID    string    `json:"device_id,omitempty"`
+}
+
+// AppliesTo сообщает, относится ли аннотация к устройству.
+func (a Annotation) AppliesTo(deviceID string) bool {
+	return a.DeviceID == "" || a.DeviceID == deviceID
 }
 
 type AnalyticsStats struct {
@@ -28,4 +145,41 @@ type AnalyticsStats struct {
 	LastAnomalyTime time.Time `json:"last_anomaly_time,omitempty"`
 	WindowSize      int       `json:"window_size"`
 	ZScoreThreshold float64   `json:"z_score_threshold"`
+	Detector        string    `json:"detector"`
+}
+
+// AnalyzerSettings - настройки анализа. В настройках устройства пустые поля
+// означают использование глобальных значений.
+type AnalyzerSettings struct {
+	Detector string `json:"detector,omitempty"`
+	// Способ расчёта скользящего среднего: mean, trimmed или winsorized
+	Average string `json:"average,omitempty"`
+	// Доля точек, отбрасываемых (trimmed) или заменяемых (winsorized) с каждого края окна
+	TrimFraction float64 `json:"trim_fraction,omitempty"`
+}
+
+// Merge возвращает настройки s, в которых непустые поля override заменяют свои.
+func (s AnalyzerSettings) Merge(override AnalyzerSettings) AnalyzerSettings {
+	if override.Detector != "" {
+		s.Detector = override.Detector
+	}
+	if override.Average != "" {
+		s.Average = override.Average
+	}
+	if override.TrimFraction != 0 {
+		s.TrimFraction = override.TrimFraction
+	}
+	return s
+}
+
+type AnalyzerConfig struct {
+	Global  AnalyzerSettings            `json:"global"`
+	Devices map[string]AnalyzerSettings `json:"devices,omitempty"`
+}
+
+// AnalyzerConfigUpdate - изменение настроек анализа. Пустой DeviceID
+// означает изменение глобальных настроек.
+type AnalyzerConfigUpdate struct {
+	DeviceID string `json:"device_id,omitempty"`
+	AnalyzerSettings
 }
@@ -0,0 +1,163 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"go-service/internal/models"
+)
+
+const alertName = "RPSAnomaly"
+
+// Alert - алерт в формате API Alertmanager v2 (POST /api/v2/alerts)
+type Alert struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+	StartsAt    time.Time         `json:"startsAt"`
+	EndsAt      time.Time         `json:"endsAt"`
+}
+
+var severityRank = map[string]int{
+	models.SeverityWarning:  1,
+	models.SeverityCritical: 2,
+}
+
+// BuildAlerts превращает аномалии (от старых к новым) в активные алерты,
+// по одному на устройство. Аномалия активна в течение activeWindow; серия
+// аномалий с промежутками не больше activeWindow образует один алерт
+// с началом в первой аномалии серии. Метка severity берётся из первой
+// аномалии серии и не меняется, пока серия идёт: метки определяют алерт
+// в Alertmanager, и эскалация иначе породила бы второй алерт. Наибольшая
+// критичность серии передаётся в аннотации max_severity. EndsAt выставляется в будущее, поэтому
+// Alertmanager сам закроет алерт, если аномалии прекратятся и алерт
+// перестанет приходить.
+func BuildAlerts(anomalies []models.AnalysisResult, devices map[string]models.Device, activeWindow time.Duration, now time.Time) []Alert {
+	byDevice := make(map[string][]models.AnalysisResult)
+	for _, anomaly := range anomalies {
+		byDevice[anomaly.Metric.DeviceID] = append(byDevice[anomaly.Metric.DeviceID], anomaly)
+	}
+
+	alerts := make([]Alert, 0, len(byDevice))
+	for deviceID, deviceAnomalies := range byDevice {
+		last := deviceAnomalies[len(deviceAnomalies)-1]
+		if now.Sub(last.Timestamp) > activeWindow {
+			continue
+		}
+
+		alerts = append(alerts, buildAlert(deviceID, deviceAnomalies, devices[deviceID], activeWindow))
+	}
+
+	sort.Slice(alerts, func(i, j int) bool {
+		return alerts[i].Labels["device_id"] < alerts[j].Labels["device_id"]
+	})
+
+	return alerts
+}
+
+// deviceStreak возвращает серию, к которой относится последняя аномалия
+// устройства. Серию ведёт анализатор по всем аномалиям устройства, а в
+// переданном списке начало серии могло уже вытесниться аномалиями других
+// устройств. Для аномалий, сохранённых без серии, она восстанавливается
+// по списку.
+func deviceStreak(anomalies []models.AnalysisResult, activeWindow time.Duration) models.AnomalyStreak {
+	last := anomalies[len(anomalies)-1]
+	if last.Streak != nil {
+		return *last.Streak
+	}
+
+	first := len(anomalies) - 1
+	for first > 0 && anomalies[first].Timestamp.Sub(anomalies[first-1].Timestamp) <= activeWindow {
+		first--
+	}
+
+	streak := models.AnomalyStreak{
+		StartedAt: anomalies[first].Timestamp,
+		LastAt:    last.Timestamp,
+		Severity:  anomalies[first].Severity,
+		Count:     len(anomalies) - first,
+	}
+	for _, anomaly := range anomalies[first:] {
+		if severityRank[anomaly.Severity] > severityRank[streak.MaxSeverity] {
+			streak.MaxSeverity = anomaly.Severity
+		}
+	}
+	return streak
+}
+
+func buildAlert(deviceID string, anomalies []models.AnalysisResult, device models.Device, activeWindow time.Duration) Alert {
+	last := anomalies[len(anomalies)-1]
+	streak := deviceStreak(anomalies, activeWindow)
+
+	// Аномалии, сохранённые до появления критичности, считаются предупреждениями
+	severity := streak.Severity
+	if severity == "" {
+		severity = models.SeverityWarning
+	}
+	maxSeverity := streak.MaxSeverity
+	if severityRank[maxSeverity] < severityRank[severity] {
+		maxSeverity = severity
+	}
+
+	var events []string
+	for _, anomaly := range anomalies {
+		if anomaly.Timestamp.Before(streak.StartedAt) {
+			continue
+		}
+		for _, annotation := range anomaly.Annotations {
+			event := fmt.Sprintf("%s %s: %s", annotation.Timestamp.UTC().Format(time.RFC3339), annotation.Type, annotation.Title)
+			if !slices.Contains(events, event) {
+				events = append(events, event)
+			}
+		}
+	}
+
+	labels := make(map[string]string, len(device.Labels)+4)
+	for k, v := range device.Labels {
+		labels[k] = v
+	}
+	labels["alertname"] = alertName
+	labels["service"] = "go-service"
+	labels["device_id"] = deviceID
+	labels["severity"] = severity
+
+	annotations := map[string]string{
+		"summary": fmt.Sprintf("Аномалия RPS на устройстве %s", deviceID),
+		"description": fmt.Sprintf("RPS %.2f при скользящем среднем %.2f (%s = %.2f), аномалий в серии: %d",
+			last.Metric.RPS, last.RollingAverage, last.Detector, last.Score, streak.Count),
+		"max_severity": maxSeverity,
+	}
+	if device.Name != "" {
+		annotations["device_name"] = device.Name
+	}
+	if device.Owner != "" {
+		annotations["owner"] = device.Owner
+	}
+	if len(events) > 0 {
+		annotations["events"] = strings.Join(events, "\n")
+	}
+
+	return Alert{
+		Labels:      labels,
+		Annotations: annotations,
+		StartsAt:    streak.StartedAt,
+		EndsAt:      last.Timestamp.Add(activeWindow),
+	}
+}
+
+// PushAlerts отправляет алерты в Alertmanager (baseURL - адрес Alertmanager).
+func PushAlerts(baseURL string, alerts []Alert) error {
+	if len(alerts) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(alerts)
+	if err != nil {
+		return err
+	}
+
+	return post(strings.TrimSuffix(baseURL, "/")+"/api/v2/alerts", payload)
+}
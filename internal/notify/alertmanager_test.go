@@ -0,0 +1,144 @@
+package notify
+
+import (
+	"testing"
+	"time"
+
+	"go-service/internal/models"
+)
+
+func anomaly(deviceID string, ts time.Time, severity string) models.AnalysisResult {
+	return models.AnalysisResult{
+		Timestamp: ts,
+		Metric:    models.Metric{DeviceID: deviceID, RPS: 500},
+		IsAnomaly: true,
+		Severity:  severity,
+		Detector:  "zscore",
+		Score:     3,
+	}
+}
+
+func TestBuildAlerts(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	window := 5 * time.Minute
+
+	anomalies := []models.AnalysisResult{
+		// Старая серия device-1, отделённая промежутком больше window
+		anomaly("device-1", now.Add(-20*time.Minute), models.SeverityCritical),
+		anomaly("device-1", now.Add(-9*time.Minute), models.SeverityWarning),
+		anomaly("device-2", now.Add(-8*time.Minute), models.SeverityWarning),
+		anomaly("device-1", now.Add(-5*time.Minute), models.SeverityCritical),
+		anomaly("device-1", now.Add(-time.Minute), models.SeverityWarning),
+	}
+	devices := map[string]models.Device{
+		"device-1": {ID: "device-1", Name: "API gateway", Owner: "platform-team", Labels: map[string]string{"env": "prod"}},
+	}
+
+	alerts := BuildAlerts(anomalies, devices, window, now)
+
+	// device-2 неактивно дольше window
+	if len(alerts) != 1 {
+		t.Fatalf("BuildAlerts returned %d alerts, want 1: %+v", len(alerts), alerts)
+	}
+
+	alert := alerts[0]
+	wantLabels := map[string]string{
+		"alertname": alertName,
+		"service":   "go-service",
+		"device_id": "device-1",
+		"severity":  models.SeverityWarning,
+		"env":       "prod",
+	}
+	if len(alert.Labels) != len(wantLabels) {
+		t.Errorf("Labels = %v, want %v", alert.Labels, wantLabels)
+	}
+	for k, v := range wantLabels {
+		if alert.Labels[k] != v {
+			t.Errorf("Labels[%s] = %q, want %q", k, alert.Labels[k], v)
+		}
+	}
+
+	if alert.Annotations["max_severity"] != models.SeverityCritical {
+		t.Errorf("max_severity = %q, want %q", alert.Annotations["max_severity"], models.SeverityCritical)
+	}
+	if alert.Annotations["device_name"] != "API gateway" || alert.Annotations["owner"] != "platform-team" {
+		t.Errorf("device annotations = %v", alert.Annotations)
+	}
+	if !alert.StartsAt.Equal(now.Add(-9 * time.Minute)) {
+		t.Errorf("StartsAt = %v, want start of current streak", alert.StartsAt)
+	}
+	if !alert.EndsAt.Equal(now.Add(-time.Minute + window)) {
+		t.Errorf("EndsAt = %v, want last anomaly + window", alert.EndsAt)
+	}
+}
+
+func TestBuildAlertsLabelsStableOnEscalation(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	window := 5 * time.Minute
+
+	anomalies := []models.AnalysisResult{
+		anomaly("device-1", now.Add(-2*time.Minute), models.SeverityWarning),
+	}
+	before := BuildAlerts(anomalies, nil, window, now)
+
+	// Эскалация серии до critical не меняет метки, иначе Alertmanager
+	// получил бы второй алерт для того же устройства
+	anomalies = append(anomalies, anomaly("device-1", now.Add(-time.Minute), models.SeverityCritical))
+	after := BuildAlerts(anomalies, nil, window, now)
+
+	if len(before) != 1 || len(after) != 1 {
+		t.Fatalf("BuildAlerts returned %d and %d alerts, want 1 and 1", len(before), len(after))
+	}
+	for k, v := range before[0].Labels {
+		if after[0].Labels[k] != v {
+			t.Errorf("label %s changed from %q to %q", k, v, after[0].Labels[k])
+		}
+	}
+	if after[0].Annotations["max_severity"] != models.SeverityCritical {
+		t.Errorf("max_severity = %q, want %q", after[0].Annotations["max_severity"], models.SeverityCritical)
+	}
+	if !after[0].StartsAt.Equal(before[0].StartsAt) {
+		t.Errorf("StartsAt changed from %v to %v", before[0].StartsAt, after[0].StartsAt)
+	}
+}
+
+func TestBuildAlertsDefaultsSeverity(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	alerts := BuildAlerts([]models.AnalysisResult{anomaly("device-1", now, "")}, nil, time.Minute, now)
+	if len(alerts) != 1 || alerts[0].Labels["severity"] != models.SeverityWarning {
+		t.Errorf("alerts = %+v, want one warning alert", alerts)
+	}
+}
+
+func TestBuildAlertsUsesTrackedStreak(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	window := 5 * time.Minute
+
+	// Начало серии вытеснено из списка аномалиями других устройств,
+	// но серия, которую ведёт анализатор, его помнит
+	last := anomaly("device-1", now.Add(-time.Minute), models.SeverityCritical)
+	last.Streak = &models.AnomalyStreak{
+		StartedAt:   now.Add(-30 * time.Minute),
+		LastAt:      last.Timestamp,
+		Severity:    models.SeverityWarning,
+		MaxSeverity: models.SeverityCritical,
+		Count:       42,
+	}
+
+	alerts := BuildAlerts([]models.AnalysisResult{last}, nil, window, now)
+	if len(alerts) != 1 {
+		t.Fatalf("BuildAlerts returned %d alerts, want 1", len(alerts))
+	}
+
+	alert := alerts[0]
+	if !alert.StartsAt.Equal(last.Streak.StartedAt) {
+		t.Errorf("StartsAt = %v, want tracked streak start %v", alert.StartsAt, last.Streak.StartedAt)
+	}
+	if alert.Labels["severity"] != models.SeverityWarning {
+		t.Errorf("severity = %q, want severity of the first anomaly in streak", alert.Labels["severity"])
+	}
+	if alert.Annotations["max_severity"] != models.SeverityCritical {
+		t.Errorf("max_severity = %q, want %q", alert.Annotations["max_severity"], models.SeverityCritical)
+	}
+}
@@ -0,0 +1,103 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"go-service/internal/config"
+)
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+func newChannel(cfg config.ChannelConfig) (Channel, error) {
+	if cfg.Name == "" {
+		return nil, errors.New("channel name is required")
+	}
+
+	switch cfg.Type {
+	case "slack":
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("channel %q: url is required", cfg.Name)
+		}
+		return slackChannel{url: cfg.URL}, nil
+	case "webhook":
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("channel %q: url is required", cfg.Name)
+		}
+		return webhookChannel{url: cfg.URL}, nil
+	case "email":
+		if cfg.SMTPAddr == "" || cfg.From == "" || len(cfg.To) == 0 {
+			return nil, fmt.Errorf("channel %q: smtp_addr, from and to are required", cfg.Name)
+		}
+		return emailChannel{addr: cfg.SMTPAddr, from: cfg.From, to: cfg.To}, nil
+	default:
+		return nil, fmt.Errorf("channel %q: unknown type %q", cfg.Name, cfg.Type)
+	}
+}
+
+// slackChannel отправляет сообщение во входящий вебхук Slack
+type slackChannel struct {
+	url string
+}
+
+func (c slackChannel) Type() string { return "slack" }
+
+func (c slackChannel) Send(msg Message) error {
+	payload, err := json.Marshal(map[string]string{"text": msg.Body})
+	if err != nil {
+		return err
+	}
+	return post(c.url, payload)
+}
+
+// webhookChannel отправляет отрендеренный шаблон как JSON-тело запроса
+type webhookChannel struct {
+	url string
+}
+
+func (c webhookChannel) Type() string { return "webhook" }
+
+func (c webhookChannel) Send(msg Message) error {
+	return post(c.url, []byte(msg.Body))
+}
+
+type emailChannel struct {
+	addr string
+	from string
+	to   []string
+}
+
+func (c emailChannel) Type() string { return "email" }
+
+func (c emailChannel) Send(msg Message) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", c.from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(c.to, ", "))
+	// Перевод строки в теме сломал бы заголовки письма
+	subject := strings.NewReplacer("\r", " ", "\n", " ").Replace(msg.Subject)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", subject)
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	buf.WriteString(msg.Body)
+
+	return smtp.SendMail(c.addr, nil, c.from, c.to, buf.Bytes())
+}
+
+func post(url string, payload []byte) error {
+	resp, err := httpClient.Post(url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
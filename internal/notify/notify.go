@@ -0,0 +1,245 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"text/template"
+
+	"go-service/internal/config"
+	"go-service/internal/models"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const queueSize = 1000
+
+var (
+	notificationsSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "notifications_sent_total",
+		Help: "Total number of anomaly notifications by channel and status",
+	}, []string{"channel", "status"})
+
+	// Отбрасывание происходит до выбора правил и каналов, поэтому без меток
+	notificationsDropped = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "notifications_dropped_total",
+		Help: "Total number of anomalies not notified because the queue was full",
+	})
+)
+
+// Шаблоны по умолчанию для каждого типа канала
+var defaultTemplates = map[string]config.TemplateConfig{
+	"slack": {
+		Body: `:rotating_light: [{{.Severity}}] Аномалия RPS на {{.Device.ID}}{{with .Device.Name}} ({{.}}){{end}}: ` +
+			`{{printf "%.2f" .Result.Metric.RPS}} при среднем {{printf "%.2f" .Result.RollingAverage}} ` +
+			`({{.Result.Detector}} = {{printf "%.2f" .Result.Score}})`,
+	},
+	"email": {
+		Subject: `[{{.Severity}}] Аномалия на устройстве {{.Device.ID}}`,
+		Body: `Устройство: {{.Device.ID}}{{with .Device.Name}} ({{.}}){{end}}
+{{with .Device.Owner}}Владелец: {{.}}
+{{end}}Время: {{.Result.Timestamp.Format "2006-01-02 15:04:05 MST"}}
+RPS: {{printf "%.2f" .Result.Metric.RPS}}
+Скользящее среднее: {{printf "%.2f" .Result.RollingAverage}}
+Детектор: {{.Result.Detector}}, оценка {{printf "%.2f" .Result.Score}}
+`,
+	},
+	"webhook": {
+		Body: `{{json .}}`,
+	},
+}
+
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"upper": strings.ToUpper,
+}
+
+// TemplateData - данные, доступные в шаблонах сообщений.
+type TemplateData struct {
+	Rule     string                `json:"rule"`
+	Severity string                `json:"severity"`
+	Result   models.AnalysisResult `json:"result"`
+	Device   models.Device         `json:"device"`
+}
+
+// Message - готовое к отправке сообщение
+type Message struct {
+	Subject string
+	Body    string
+}
+
+type Channel interface {
+	Type() string
+	Send(msg Message) error
+}
+
+type messageTemplate struct {
+	subject *template.Template
+	body    *template.Template
+}
+
+type rule struct {
+	name      string
+	severity  string
+	devices   []string
+	channels  []string
+	templates map[string]messageTemplate
+}
+
+func (r rule) matches(result models.AnalysisResult) bool {
+	if r.severity != "" && r.severity != result.Severity {
+		return false
+	}
+	return len(r.devices) == 0 || slices.Contains(r.devices, result.Metric.DeviceID)
+}
+
+// Notifier рассылает уведомления об аномалиях по правилам из конфигурации.
+// Отправка выполняется в отдельной горутине (Run), чтобы не задерживать обработку метрик.
+type Notifier struct {
+	channels map[string]Channel
+	rules    []rule
+	devices  map[string]models.Device
+	queue    chan models.AnalysisResult
+}
+
+func NewNotifier(cfg config.NotificationsConfig, devices map[string]models.Device) (*Notifier, error) {
+	n := &Notifier{
+		channels: make(map[string]Channel, len(cfg.Channels)),
+		devices:  devices,
+		queue:    make(chan models.AnalysisResult, queueSize),
+	}
+
+	for _, c := range cfg.Channels {
+		channel, err := newChannel(c)
+		if err != nil {
+			return nil, err
+		}
+		n.channels[c.Name] = channel
+	}
+
+	for _, rc := range cfg.Rules {
+		r := rule{
+			name:      rc.Name,
+			severity:  rc.Severity,
+			devices:   rc.Devices,
+			channels:  rc.Channels,
+			templates: make(map[string]messageTemplate),
+		}
+
+		for _, name := range rc.Channels {
+			channel, ok := n.channels[name]
+			if !ok {
+				return nil, fmt.Errorf("rule %q: unknown channel %q", rc.Name, name)
+			}
+
+			tmplCfg, ok := rc.Templates[channel.Type()]
+			if !ok {
+				tmplCfg = defaultTemplates[channel.Type()]
+			}
+
+			tmpl, err := parseTemplate(fmt.Sprintf("%s/%s", rc.Name, channel.Type()), tmplCfg)
+			if err != nil {
+				return nil, fmt.Errorf("rule %q: %w", rc.Name, err)
+			}
+			r.templates[channel.Type()] = tmpl
+		}
+
+		n.rules = append(n.rules, r)
+	}
+
+	return n, nil
+}
+
+func parseTemplate(name string, cfg config.TemplateConfig) (messageTemplate, error) {
+	var tmpl messageTemplate
+	var err error
+
+	tmpl.body, err = template.New(name + "/body").Funcs(templateFuncs).Option("missingkey=zero").Parse(cfg.Body)
+	if err != nil {
+		return tmpl, fmt.Errorf("invalid template %s: %w", name, err)
+	}
+
+	tmpl.subject, err = template.New(name + "/subject").Funcs(templateFuncs).Option("missingkey=zero").Parse(cfg.Subject)
+	if err != nil {
+		return tmpl, fmt.Errorf("invalid subject template %s: %w", name, err)
+	}
+
+	return tmpl, nil
+}
+
+// Notify ставит аномалию в очередь на отправку. Если очередь переполнена,
+// уведомление отбрасывается.
+func (n *Notifier) Notify(result models.AnalysisResult) {
+	if len(n.rules) == 0 {
+		return
+	}
+
+	select {
+	case n.queue <- result:
+	default:
+		notificationsDropped.Inc()
+	}
+}
+
+func (n *Notifier) Run() {
+	for result := range n.queue {
+		n.dispatch(result)
+	}
+}
+
+func (n *Notifier) dispatch(result models.AnalysisResult) {
+	device, ok := n.devices[result.Metric.DeviceID]
+	if !ok {
+		device = models.Device{ID: result.Metric.DeviceID}
+	}
+
+	for _, r := range n.rules {
+		if !r.matches(result) {
+			continue
+		}
+
+		data := TemplateData{
+			Rule:     r.name,
+			Severity: result.Severity,
+			Result:   result,
+			Device:   device,
+		}
+
+		for _, name := range r.channels {
+			channel := n.channels[name]
+
+			msg, err := r.templates[channel.Type()].render(data)
+			if err != nil {
+				log.Printf("Failed to render notification for rule %s, channel %s: %v", r.name, name, err)
+				notificationsSent.WithLabelValues(name, "error").Inc()
+				continue
+			}
+
+			if err := channel.Send(msg); err != nil {
+				log.Printf("Failed to send notification to %s: %v", name, err)
+				notificationsSent.WithLabelValues(name, "error").Inc()
+				continue
+			}
+			notificationsSent.WithLabelValues(name, "sent").Inc()
+		}
+	}
+}
+
+func (t messageTemplate) render(data TemplateData) (Message, error) {
+	var subject, body strings.Builder
+
+	if err := t.subject.Execute(&subject, data); err != nil {
+		return Message{}, err
+	}
+	if err := t.body.Execute(&body, data); err != nil {
+		return Message{}, err
+	}
+
+	return Message{Subject: subject.String(), Body: body.String()}, nil
+}
@@ -0,0 +1,214 @@
+package notify
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"go-service/internal/config"
+	"go-service/internal/models"
+)
+
+// recordingChannel запоминает отправленные сообщения вместо доставки
+type recordingChannel struct {
+	typ      string
+	messages []Message
+}
+
+func (c *recordingChannel) Type() string { return c.typ }
+
+func (c *recordingChannel) Send(msg Message) error {
+	c.messages = append(c.messages, msg)
+	return nil
+}
+
+var testChannels = []config.ChannelConfig{
+	{Name: "ops-slack", Type: "slack", URL: "http://slack.invalid/hook"},
+	{Name: "oncall-email", Type: "email", SMTPAddr: "smtp.invalid:25", From: "go-service@example.com", To: []string{"oncall@example.com"}},
+	{Name: "incident-hook", Type: "webhook", URL: "http://hook.invalid"},
+}
+
+var testDevices = map[string]models.Device{
+	"device-1": {ID: "device-1", Name: "API gateway", Owner: "platform-team", Location: "eu-west"},
+}
+
+func testResult(deviceID, severity string) models.AnalysisResult {
+	return models.AnalysisResult{
+		Timestamp:      time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		Metric:         models.Metric{DeviceID: deviceID, RPS: 512.5},
+		RollingAverage: 100,
+		Detector:       "ewma",
+		Score:          4.25,
+		IsAnomaly:      true,
+		Severity:       severity,
+	}
+}
+
+// newTestNotifier создаёт уведомитель и подменяет каналы записывающими
+func newTestNotifier(t *testing.T, rules []config.RuleConfig) (*Notifier, map[string]*recordingChannel) {
+	t.Helper()
+
+	n, err := NewNotifier(config.NotificationsConfig{Channels: testChannels, Rules: rules}, testDevices)
+	if err != nil {
+		t.Fatalf("NewNotifier: %v", err)
+	}
+
+	recorders := make(map[string]*recordingChannel)
+	for name, channel := range n.channels {
+		recorder := &recordingChannel{typ: channel.Type()}
+		n.channels[name] = recorder
+		recorders[name] = recorder
+	}
+
+	return n, recorders
+}
+
+func TestCustomTemplateRendering(t *testing.T) {
+	n, recorders := newTestNotifier(t, []config.RuleConfig{{
+		Name:     "critical",
+		Channels: []string{"ops-slack", "oncall-email"},
+		Templates: map[string]config.TemplateConfig{
+			"slack": {Body: `{{.Rule}}: {{.Device.Name}} ({{.Device.Owner}}, {{.Device.Location}}) RPS {{printf "%.1f" .Result.Metric.RPS}}`},
+			"email": {
+				Subject: `[{{upper .Severity}}] {{.Device.ID}}`,
+				Body:    `{{.Result.Detector}} score {{printf "%.2f" .Result.Score}} at {{.Result.Timestamp.Format "15:04"}}`,
+			},
+		},
+	}})
+
+	n.dispatch(testResult("device-1", models.SeverityCritical))
+
+	slack := recorders["ops-slack"].messages
+	if len(slack) != 1 || slack[0].Body != "critical: API gateway (platform-team, eu-west) RPS 512.5" {
+		t.Errorf("slack messages = %+v", slack)
+	}
+
+	email := recorders["oncall-email"].messages
+	if len(email) != 1 {
+		t.Fatalf("email messages = %+v", email)
+	}
+	if email[0].Subject != "[CRITICAL] device-1" {
+		t.Errorf("email subject = %q", email[0].Subject)
+	}
+	if email[0].Body != "ewma score 4.25 at 12:00" {
+		t.Errorf("email body = %q", email[0].Body)
+	}
+}
+
+func TestDefaultTemplatesPerChannelType(t *testing.T) {
+	// Шаблон задан только для slack, email и webhook получают встроенные
+	n, recorders := newTestNotifier(t, []config.RuleConfig{{
+		Name:     "all",
+		Channels: []string{"ops-slack", "oncall-email", "incident-hook"},
+		Templates: map[string]config.TemplateConfig{
+			"slack": {Body: "custom {{.Device.ID}}"},
+		},
+	}})
+
+	n.dispatch(testResult("device-1", models.SeverityWarning))
+
+	if got := recorders["ops-slack"].messages; len(got) != 1 || got[0].Body != "custom device-1" {
+		t.Errorf("slack messages = %+v", got)
+	}
+
+	email := recorders["oncall-email"].messages
+	if len(email) != 1 {
+		t.Fatalf("email messages = %+v", email)
+	}
+	if email[0].Subject != "[warning] Аномалия на устройстве device-1" {
+		t.Errorf("email subject = %q", email[0].Subject)
+	}
+	for _, want := range []string{"device-1 (API gateway)", "Владелец: platform-team", "RPS: 512.50", "оценка 4.25"} {
+		if !strings.Contains(email[0].Body, want) {
+			t.Errorf("email body %q does not contain %q", email[0].Body, want)
+		}
+	}
+
+	webhook := recorders["incident-hook"].messages
+	if len(webhook) != 1 {
+		t.Fatalf("webhook messages = %+v", webhook)
+	}
+	var payload TemplateData
+	if err := json.Unmarshal([]byte(webhook[0].Body), &payload); err != nil {
+		t.Fatalf("webhook body is not JSON: %v", err)
+	}
+	if payload.Rule != "all" || payload.Device.Owner != "platform-team" || payload.Result.Metric.RPS != 512.5 {
+		t.Errorf("webhook payload = %+v", payload)
+	}
+}
+
+func TestUnknownDeviceRendersWithID(t *testing.T) {
+	n, recorders := newTestNotifier(t, []config.RuleConfig{{
+		Name:     "all",
+		Channels: []string{"ops-slack"},
+	}})
+
+	n.dispatch(testResult("device-9", models.SeverityWarning))
+
+	got := recorders["ops-slack"].messages
+	if len(got) != 1 || !strings.Contains(got[0].Body, "на device-9:") {
+		t.Errorf("slack messages = %+v", got)
+	}
+}
+
+func TestRuleMatches(t *testing.T) {
+	tests := []struct {
+		name   string
+		rule   rule
+		result models.AnalysisResult
+		want   bool
+	}{
+		{"any", rule{}, testResult("device-1", models.SeverityWarning), true},
+		{"severity match", rule{severity: models.SeverityCritical}, testResult("device-1", models.SeverityCritical), true},
+		{"severity mismatch", rule{severity: models.SeverityCritical}, testResult("device-1", models.SeverityWarning), false},
+		{"device match", rule{devices: []string{"device-1", "device-2"}}, testResult("device-2", models.SeverityWarning), true},
+		{"device mismatch", rule{devices: []string{"device-1"}}, testResult("device-3", models.SeverityWarning), false},
+		{"both match", rule{severity: models.SeverityWarning, devices: []string{"device-1"}}, testResult("device-1", models.SeverityWarning), true},
+		{"device matches, severity not", rule{severity: models.SeverityCritical, devices: []string{"device-1"}}, testResult("device-1", models.SeverityWarning), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule.matches(tt.result); got != tt.want {
+				t.Errorf("matches = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDispatchOnlyMatchingRules(t *testing.T) {
+	n, recorders := newTestNotifier(t, []config.RuleConfig{
+		{Name: "critical", Severity: models.SeverityCritical, Channels: []string{"oncall-email"}},
+		{Name: "warnings", Severity: models.SeverityWarning, Channels: []string{"ops-slack"}},
+	})
+
+	n.dispatch(testResult("device-1", models.SeverityWarning))
+
+	if got := len(recorders["ops-slack"].messages); got != 1 {
+		t.Errorf("slack got %d messages, want 1", got)
+	}
+	if got := len(recorders["oncall-email"].messages); got != 0 {
+		t.Errorf("email got %d messages, want 0", got)
+	}
+}
+
+func TestNewNotifierErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []config.RuleConfig
+	}{
+		{"unknown channel", []config.RuleConfig{{Name: "r", Channels: []string{"missing"}}}},
+		{"invalid template", []config.RuleConfig{{
+			Name:      "r",
+			Channels:  []string{"ops-slack"},
+			Templates: map[string]config.TemplateConfig{"slack": {Body: "{{.Device.ID"}},
+		}}},
+	}
+
+	for _, tt := range tests {
+		if _, err := NewNotifier(config.NotificationsConfig{Channels: testChannels, Rules: tt.rules}, nil); err == nil {
+			t.Errorf("%s: expected error", tt.name)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package usage
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"go-service/internal/models"
+)
+
+// Категории учитываемых запросов
+const (
+	Ingest = "ingest"
+	Query  = "query"
+)
+
+// Тенанты для запросов без ключа и с ключом, которого нет в конфигурации
+const (
+	TenantAnonymous = "anonymous"
+	TenantUnknown   = "unknown"
+)
+
+type Store interface {
+	AddUsage(day, tenant string, counters models.UsageCounters) error
+}
+
+type usageKey struct {
+	day    string
+	tenant string
+}
+
+// Tracker копит счётчики использования в памяти и периодически сбрасывает
+// их в хранилище, чтобы не обращаться к Redis на каждый запрос.
+type Tracker struct {
+	store   Store
+	apiKeys map[string]string
+	pending map[usageKey]models.UsageCounters
+	mu      sync.Mutex
+}
+
+// NewTracker создаёт трекер. apiKeys сопоставляет API-ключ с тенантом.
+func NewTracker(store Store, apiKeys map[string]string) *Tracker {
+	return &Tracker{
+		store:   store,
+		apiKeys: apiKeys,
+		pending: make(map[usageKey]models.UsageCounters),
+	}
+}
+
+// Tenant определяет тенанта по API-ключу запроса.
+func (t *Tracker) Tenant(apiKey string) string {
+	if apiKey == "" {
+		return TenantAnonymous
+	}
+	if tenant, ok := t.apiKeys[apiKey]; ok {
+		return tenant
+	}
+	return TenantUnknown
+}
+
+func (t *Tracker) Record(tenant, category string, bytes int64) {
+	key := usageKey{day: time.Now().UTC().Format(models.UsageDayFormat), tenant: tenant}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	counters := t.pending[key]
+	switch category {
+	case Ingest:
+		counters.IngestRequests++
+		counters.IngestBytes += bytes
+	case Query:
+		counters.QueryRequests++
+		counters.QueryBytes += bytes
+	default:
+		return
+	}
+	t.pending[key] = counters
+}
+
+// Run сбрасывает накопленные счётчики с заданным интервалом.
+func (t *Tracker) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		t.Flush()
+	}
+}
+
+// Flush записывает накопленные счётчики в хранилище. Счётчики, которые
+// не удалось записать, остаются до следующего сброса.
+func (t *Tracker) Flush() {
+	t.mu.Lock()
+	pending := t.pending
+	t.pending = make(map[usageKey]models.UsageCounters)
+	t.mu.Unlock()
+
+	for key, counters := range pending {
+		if err := t.store.AddUsage(key.day, key.tenant, counters); err != nil {
+			log.Printf("Failed to flush usage for %s: %v", key.tenant, err)
+			t.restore(key, counters)
+		}
+	}
+}
+
+func (t *Tracker) restore(key usageKey, counters models.UsageCounters) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	current := t.pending[key]
+	current.IngestRequests += counters.IngestRequests
+	current.IngestBytes += counters.IngestBytes
+	current.QueryRequests += counters.QueryRequests
+	current.QueryBytes += counters.QueryBytes
+	t.pending[key] = current
+}